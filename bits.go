@@ -0,0 +1,148 @@
+package pack
+
+import "reflect"
+
+// Reports whether struct fields of kind can be bit-packed with the bits tag
+func isBitsKind(kind reflect.Kind) bool {
+	return kind == reflect.Bool || isDeltaKind(kind)
+}
+
+// Get a field as the low bits of a number, checking that it fits
+func bitsValue(val reflect.Value, bits uint8) (uint64, error) {
+	var num uint64
+
+	switch val.Kind() {
+	case reflect.Bool:
+		if val.Bool() {
+			num = 1
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := val.Int()
+
+		if bits < 64 && (i < -1<<(bits-1) || i > 1<<(bits-1)-1) {
+			return 0, &ErrOutOfRange{typ: val.Type(), bits: bits, value: i}
+		}
+
+		num = uint64(i)
+
+	default:
+		num = val.Uint()
+
+		if bits < 64 && num>>bits != 0 {
+			return 0, &ErrOutOfRange{typ: val.Type(), bits: bits, value: num}
+		}
+	}
+
+	if bits < 64 {
+		num &= 1<<bits - 1
+	}
+
+	return num, nil
+}
+
+// Set a field from the low bits of a number
+func setBitsValue(val reflect.Value, num uint64, bits uint8) error {
+	switch val.Kind() {
+	case reflect.Bool:
+		val.SetBool(num != 0)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := int64(num<<(64-bits)) >> (64 - bits)
+
+		if val.OverflowInt(i) {
+			return &ErrOutOfRange{typ: val.Type(), bits: bits, value: i}
+		}
+
+		val.SetInt(i)
+
+	default:
+		if val.OverflowUint(num) {
+			return &ErrOutOfRange{typ: val.Type(), bits: bits, value: num}
+		}
+
+		val.SetUint(num)
+	}
+
+	return nil
+}
+
+// Encode a run of consecutive bits tagged fields of a struct into a shared
+// bitstream, least significant bit first as in encodeBoolSlice
+func (p *packer) encodeBits(val reflect.Value, fields []fieldInfo) error {
+	var (
+		cur byte
+		n   uint8
+	)
+
+	for _, field := range fields {
+		num, err := bitsValue(val.Field(field.index), field.info.bits)
+		if err != nil {
+			return err
+		}
+
+		for left := field.info.bits; left > 0; {
+			take := min(left, 8-n)
+
+			cur |= byte(num&(1<<take-1)) << n
+			num >>= take
+			left -= take
+			n += take
+
+			if n == 8 {
+				err = p.writeByte(cur)
+				if err != nil {
+					return err
+				}
+
+				cur, n = 0, 0
+			}
+		}
+	}
+
+	if n > 0 {
+		return p.writeByte(cur)
+	}
+
+	return nil
+}
+
+func (u *unpacker) decodeBits(val reflect.Value, fields []fieldInfo) error {
+	var (
+		cur byte
+		n   uint8
+	)
+
+	for _, field := range fields {
+		var (
+			bits = field.info.bits
+			num  uint64
+		)
+
+		for got := uint8(0); got < bits; {
+			if n == 0 {
+				read, err := u.reader.Read(u.buffer[:1])
+				u.read += uint64(read)
+				if err != nil {
+					return err
+				}
+
+				cur, n = u.buffer[0], 8
+			}
+
+			take := min(bits-got, n)
+
+			num |= uint64(cur&(1<<take-1)) << got
+			cur >>= take
+			got += take
+			n -= take
+		}
+
+		err := setBitsValue(val.Field(field.index), num, bits)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
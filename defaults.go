@@ -0,0 +1,69 @@
+package pack
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+var typeDuration = reflect.TypeOf(time.Duration(0))
+
+// Parse a value given in a tag, such as a default, as a value of typ
+func parseTagValue(typ reflect.Type, str string) (reflect.Value, error) {
+	var (
+		val = reflect.New(typ).Elem()
+		err error
+	)
+
+	switch typ.Kind() {
+	case reflect.String:
+		val.SetString(str)
+
+	case reflect.Bool:
+		var b bool
+		b, err = strconv.ParseBool(str)
+		val.SetBool(b)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		if typ == typeDuration {
+			var d time.Duration
+			d, err = time.ParseDuration(str)
+			i = int64(d)
+		} else {
+			i, err = strconv.ParseInt(str, 0, typ.Bits())
+		}
+		val.SetInt(i)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var u uint64
+		u, err = strconv.ParseUint(str, 0, typ.Bits())
+		val.SetUint(u)
+
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		f, err = strconv.ParseFloat(str, typ.Bits())
+		val.SetFloat(f)
+
+	default:
+		err = fmt.Errorf("values of kind %s may not be given in a tag", typ.Kind())
+	}
+
+	return val, err
+}
+
+// Reports whether an optional field holds its default value, which is the
+// value of its default tag, the value set by PackDefaults or zero, so it may
+// be left out
+func (f *fieldInfo) isDefault(val reflect.Value) bool {
+	if !f.def.IsValid() {
+		return val.IsZero()
+	}
+
+	if f.def.Comparable() {
+		return val.Equal(f.def)
+	}
+
+	return reflect.DeepEqual(val.Interface(), f.def.Interface())
+}
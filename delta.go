@@ -0,0 +1,171 @@
+package pack
+
+import (
+	"errors"
+	"reflect"
+)
+
+// Delta encodings of integer slices and arrays, see packerInfo.delta
+const (
+	deltaNone = iota
+
+	// Every element is stored as the difference from the previous one
+	deltaFirst
+
+	// Every element is stored as the difference between its delta and the
+	// delta of the previous one, which is 0 for values growing at a steady
+	// rate such as timestamps
+	deltaSecond
+)
+
+// Reports whether slices and arrays with elements of kind can be delta
+// encoded
+func isDeltaKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+
+	return false
+}
+
+// Check that a struct field of typ may be tagged with delta or delta2
+func checkDeltaTag(typ reflect.Type) error {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	switch typ.Kind() {
+	case reflect.Slice:
+		// Packed as raw bytes before delta encoding is considered
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return errors.New("[]byte may not be delta encoded, use an array or a wider integer type")
+		}
+
+		fallthrough
+
+	case reflect.Array:
+		if isDeltaKind(typ.Elem().Kind()) {
+			return nil
+		}
+	}
+
+	return errors.New("only slices and arrays of integers may be delta encoded")
+}
+
+func isSignedKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+
+	return false
+}
+
+// Write a signed number as an element of kind would be, differences may be
+// negative even for unsigned elements so they are always signed
+func (p *packer) writeInt(i int64, kind reflect.Kind, info packerInfo) error {
+	if info.order != nil {
+		return p.writeFixed(uint64(i), fixedSize(kind), info.order)
+	}
+
+	if info.zigzag || p.zigzag {
+		return p.writeVarUint(zigzag(i))
+	}
+
+	return p.writeVarInt(i)
+}
+
+func (u *unpacker) readInt(kind reflect.Kind, info packerInfo) (int64, error) {
+	if info.order != nil {
+		size := fixedSize(kind)
+
+		num, err := u.readFixed(size, info.order)
+
+		return signExtend(num, size), err
+	}
+
+	var (
+		num int64
+		n   int
+		err error
+	)
+
+	if info.zigzag || u.zigzag {
+		n, err = ReadZigZag(u.reader, &num, u.buffer[:])
+	} else {
+		n, err = ReadVarInt(u.reader, &num, u.buffer[:])
+	}
+	u.read += uint64(n)
+
+	return num, err
+}
+
+// Encode the elements of an integer slice or array as deltas, arithmetic
+// wraps around so every value is restored exactly
+func (p *packer) encodeDelta(val reflect.Value, info packerInfo) error {
+	var (
+		kind   = val.Type().Elem().Kind()
+		signed = isSignedKind(kind)
+		ln     = val.Len()
+
+		prev, prevDelta int64
+	)
+
+	for i := 0; i < ln; i++ {
+		var cur int64
+
+		if signed {
+			cur = val.Index(i).Int()
+		} else {
+			cur = int64(val.Index(i).Uint())
+		}
+
+		delta := cur - prev
+		prev = cur
+
+		if info.delta == deltaSecond {
+			delta, prevDelta = delta-prevDelta, delta
+		}
+
+		err := p.writeInt(delta, kind, info)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (u *unpacker) decodeDelta(val reflect.Value, info packerInfo) error {
+	var (
+		kind   = val.Type().Elem().Kind()
+		signed = isSignedKind(kind)
+		ln     = val.Len()
+
+		prev, prevDelta int64
+	)
+
+	for i := 0; i < ln; i++ {
+		delta, err := u.readInt(kind, info)
+		if err != nil {
+			return err
+		}
+
+		if info.delta == deltaSecond {
+			prevDelta += delta
+			delta = prevDelta
+		}
+
+		prev += delta
+
+		if signed {
+			val.Index(i).SetInt(prev)
+		} else {
+			val.Index(i).SetUint(uint64(prev))
+		}
+	}
+
+	return nil
+}
@@ -14,6 +14,11 @@ var (
 	ErrNilObject                = errors.New("may not encode nil in object mode")
 	ErrMustBePointerToInterface = errors.New("in Objects mode, value given to Decode must be of type *interface{}")
 	ErrCycle                    = errors.New("circular reference detected")
+	ErrReaderStarted            = errors.New("may not read from Socket directly after Incoming or Err was called")
+	ErrTimeoutUnsupported       = errors.New("underlying stream of Socket does not support timeouts")
+	ErrMissingFile              = errors.New("message references a file descriptor that was not received")
+	ErrPoolClosed               = errors.New("pool is closed")
+	ErrInvalidReference         = errors.New("reference to a value that was not decoded yet")
 )
 
 type ErrNotDefined struct {
@@ -66,3 +71,93 @@ type ErrCantUseInInterfaceMode struct {
 func (e *ErrCantUseInInterfaceMode) Error() string {
 	return fmt.Sprintf("cannot encode type %q in interface mode in %q", e.kind, e.typ.String())
 }
+
+type ErrFilesUnsupported struct {
+	typ reflect.Type
+}
+
+func (e *ErrFilesUnsupported) Error() string {
+	return fmt.Sprintf("values of type %q can only be passed over a Socket on a *net.UnixConn", e.typ.String())
+}
+
+type ErrCycleAt struct {
+	path string
+}
+
+func (e *ErrCycleAt) Error() string {
+	if e.path == "" {
+		return ErrCycle.Error()
+	}
+
+	return fmt.Sprintf("%s at %s", ErrCycle.Error(), e.path)
+}
+
+func (e *ErrCycleAt) Unwrap() error {
+	return ErrCycle
+}
+
+// Prepend a step to the field path of an error returned from within it, so
+// paths are only built once something went wrong
+func inPath(err error, step string) error {
+	switch err := err.(type) {
+	case *ErrCycleAt:
+		err.path = step + err.path
+	case *ErrValidation:
+		err.path = step + err.path
+	}
+
+	return err
+}
+
+type ErrOutOfRange struct {
+	typ  reflect.Type
+	bits uint8
+
+	value any
+}
+
+func (e *ErrOutOfRange) Error() string {
+	return fmt.Sprintf("value %v of type %q does not fit in %d bits", e.value, e.typ.String(), e.bits)
+}
+
+type ErrInvalidTag struct {
+	typ   reflect.Type
+	field string
+	tag   string
+
+	err error
+}
+
+func (e *ErrInvalidTag) Error() string {
+	return fmt.Sprintf("invalid pack tag %q on field %s of %q: %v", e.tag, e.field, e.typ.String(), e.err)
+}
+
+func (e *ErrInvalidTag) Unwrap() error {
+	return e.err
+}
+
+type ErrValidation struct {
+	path string
+	rule string
+
+	value any
+}
+
+func (e *ErrValidation) Error() string {
+	return fmt.Sprintf("field %s with value %#v does not satisfy %q", e.path, e.value, e.rule)
+}
+
+// Get the path to the field that failed validation, such as .Members[core][1].Name
+func (e *ErrValidation) Path() string {
+	return e.path
+}
+
+// Get the tag of the rule the field does not satisfy, such as max:150
+func (e *ErrValidation) Rule() string {
+	return e.rule
+}
+
+// Get the value of the field that failed validation
+func (e *ErrValidation) Value() any {
+	return e.value
+}
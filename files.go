@@ -0,0 +1,202 @@
+package pack
+
+import (
+	"io"
+	"net"
+	"os"
+	"reflect"
+)
+
+var (
+	typeFile     = reflect.TypeOf((*os.File)(nil))
+	typeConn     = reflect.TypeOf((*net.Conn)(nil)).Elem()
+	typeListener = reflect.TypeOf((*net.Listener)(nil)).Elem()
+)
+
+// Reports whether values of typ are sent as file descriptors
+func isFileType(typ reflect.Type) bool {
+	return typ == typeFile || typ == typeConn || typ == typeListener
+}
+
+// Files passed alongside a packed message, values of type *os.File,
+// net.Conn and net.Listener are encoded as an index into this table
+//
+// Only Sockets on a *net.UnixConn, on unix systems, are able to pass files
+type fileTable struct {
+	files []*os.File
+
+	// Descriptors duplicated while encoding, to be closed once sent
+	owned []*os.File
+
+	// Files received while reading, in the order they arrived
+	received []fileBatch
+
+	// Stream offset of the message being decoded
+	pos uint64
+
+	// Values created from received files by the message being decoded,
+	// closed if decoding fails
+	decoded []io.Closer
+}
+
+// Files received along with the bytes [from, to) of the stream
+//
+// The kernel attaches descriptors to the start of the message they were sent
+// with and stops a read right after them, so they belong to the last message
+// starting within the read
+type fileBatch struct {
+	from, to uint64
+	files    []*os.File
+}
+
+// Close files owned by the table and empty it
+func (t *fileTable) reset() {
+	for _, file := range t.owned {
+		file.Close()
+	}
+
+	t.files = t.files[:0]
+	t.owned = t.owned[:0]
+}
+
+// Add files received along with n bytes read at offset
+func (t *fileTable) receive(offset uint64, n int, files []*os.File) {
+	t.received = append(t.received, fileBatch{from: offset, to: offset + uint64(n), files: files})
+}
+
+// Files sent with the message being decoded
+func (t *fileTable) current() []*os.File {
+	for _, batch := range t.received {
+		if batch.from <= t.pos && t.pos < batch.to {
+			return batch.files
+		}
+	}
+
+	return nil
+}
+
+// Close and drop the files received with messages ending before end, the
+// one just decoded included, that were not handed out to the receiver
+//
+// If decoding failed, values already created from its files are closed too
+func (t *fileTable) finish(end uint64, failed bool) {
+	if failed {
+		for _, value := range t.decoded {
+			value.Close()
+		}
+	}
+
+	t.decoded = t.decoded[:0]
+
+	var i int
+	for ; i < len(t.received) && t.received[i].to <= end; i++ {
+		for _, file := range t.received[i].files {
+			if file != nil {
+				file.Close()
+			}
+		}
+	}
+
+	t.received = append(t.received[:0], t.received[i:]...)
+	t.pos = end
+}
+
+type filer interface {
+	File() (*os.File, error)
+}
+
+func (p *packer) encodeFile(val reflect.Value) error {
+	var idx int64 = -1
+
+	if val.Kind() == reflect.Interface {
+		val = val.Elem()
+	}
+
+	if val.IsValid() && !(val.Kind() == reflect.Pointer && val.IsNil()) {
+		if p.files == nil {
+			return &ErrFilesUnsupported{typ: val.Type()}
+		}
+
+		var file *os.File
+
+		switch data := val.Interface().(type) {
+		case *os.File:
+			file = data
+
+		case filer:
+			// net.Conn and net.Listener implementations return a duplicate of
+			// their descriptor, which is closed once the message is sent
+			dup, err := data.File()
+			if err != nil {
+				return err
+			}
+
+			p.files.owned = append(p.files.owned, dup)
+			file = dup
+
+		default:
+			return &ErrInvalidType{typ: val.Type()}
+		}
+
+		idx = int64(len(p.files.files))
+		p.files.files = append(p.files.files, file)
+	}
+
+	return p.writeVarInt(idx)
+}
+
+func (u *unpacker) decodeFile(val reflect.Value) error {
+	var idx int64
+
+	n, err := ReadVarInt(u.reader, &idx, u.buffer[:])
+	u.read += uint64(n)
+	if err != nil {
+		return err
+	}
+
+	if idx < 0 {
+		val.SetZero()
+		return nil
+	}
+
+	if u.files == nil {
+		return &ErrFilesUnsupported{typ: val.Type()}
+	}
+
+	files := u.files.current()
+	if idx >= int64(len(files)) || files[idx] == nil {
+		return ErrMissingFile
+	}
+
+	// Taken out of the table, so it is not closed once decoded
+	file := files[idx]
+	files[idx] = nil
+
+	switch val.Type() {
+	case typeFile:
+		u.files.decoded = append(u.files.decoded, file)
+		val.Set(reflect.ValueOf(file))
+
+	case typeConn:
+		conn, err := net.FileConn(file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+
+		u.files.decoded = append(u.files.decoded, conn)
+		val.Set(reflect.ValueOf(conn))
+
+	case typeListener:
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+
+		u.files.decoded = append(u.files.decoded, listener)
+		val.Set(reflect.ValueOf(listener))
+	}
+
+	return nil
+}
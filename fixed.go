@@ -0,0 +1,80 @@
+package pack
+
+import (
+	"encoding/binary"
+	"io"
+	"reflect"
+)
+
+// Get the width in bytes of numbers of given kind when encoded with a fixed
+// width, int and uint always take 8 bytes so the width does not depend on
+// the platform
+func fixedSize(kind reflect.Kind) int {
+	switch kind {
+	case reflect.Int8, reflect.Uint8:
+		return 1
+	case reflect.Int16, reflect.Uint16:
+		return 2
+	case reflect.Int32, reflect.Uint32:
+		return 4
+	}
+
+	return 8
+}
+
+// Get the byte order of floats, which are big-endian unless told otherwise
+func floatOrder(info packerInfo) binary.ByteOrder {
+	if info.order != nil {
+		return info.order
+	}
+
+	return binary.BigEndian
+}
+
+// Sign extend a number of given width read with readFixed
+func signExtend(i uint64, size int) int64 {
+	switch size {
+	case 1:
+		return int64(int8(i))
+	case 2:
+		return int64(int16(i))
+	case 4:
+		return int64(int32(i))
+	}
+
+	return int64(i)
+}
+
+func (p *packer) writeFixed(i uint64, size int, order binary.ByteOrder) error {
+	switch size {
+	case 1:
+		p.buffer[0] = byte(i)
+	case 2:
+		order.PutUint16(p.buffer[:2], uint16(i))
+	case 4:
+		order.PutUint32(p.buffer[:4], uint32(i))
+	default:
+		order.PutUint64(p.buffer[:8], i)
+	}
+
+	return p.write(p.buffer[:size])
+}
+
+func (u *unpacker) readFixed(size int, order binary.ByteOrder) (uint64, error) {
+	n, err := io.ReadFull(u.reader, u.buffer[:size])
+	u.read += uint64(n)
+	if err != nil {
+		return 0, err
+	}
+
+	switch size {
+	case 1:
+		return uint64(u.buffer[0]), nil
+	case 2:
+		return uint64(order.Uint16(u.buffer[:2])), nil
+	case 4:
+		return uint64(order.Uint32(u.buffer[:4])), nil
+	}
+
+	return order.Uint64(u.buffer[:8]), nil
+}
@@ -1,8 +1,12 @@
 package pack
 
 import (
+	"encoding/binary"
+	"errors"
+	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 type packerInfo struct {
@@ -11,6 +15,7 @@ type packerInfo struct {
 	//
 	// string: max encoded bytes
 	// slice/map: max elements
+	// numbers: checked as the max value instead, see validation
 	maxSize uint64
 
 	// Ignore this field
@@ -23,14 +28,60 @@ type packerInfo struct {
 
 	objects string
 
+	// Must be encoded as a file descriptor, see fileTable
+	file bool
+
 	forceAsObject bool
 
-	seen seen
+	// Encode numbers with a fixed width in this byte order instead of as
+	// VarInts, nil means the default encoding
+	order binary.ByteOrder
+
+	// Encode signed integers with ZigZag encoding instead of as VarInts
+	zigzag bool
+
+	// Delta encoding of integer slices and arrays, one of deltaNone,
+	// deltaFirst or deltaSecond
+	delta uint8
+
+	// Number of bits a struct field takes in a bitstream shared with the
+	// consecutive bit-packed fields around it, 0 if not bit-packed
+	bits uint8
+
+	// Value of the bits tag as written, checked by structFields
+	rawBits string
+	hasBits bool
+
+	// Encode strings through the string table, see Options.Intern
+	intern bool
+
+	// Leave the struct field out when it's zero, its presence is kept in a
+	// bitmap written before the fields of the struct
+	omitEmpty bool
+
+	// Value of the struct field when it's absent, as written in the tag,
+	// optional fields are left out when they hold it
+	//
+	// A default does not make the field optional by itself, it also needs
+	// omitempty or the struct wide opt-in, so adding one does not change
+	// how the struct is packed
+	defaultValue string
+	hasDefault   bool
+
+	// Checks of the validation tags of the struct field, nil if it has none
+	validate *validation
+}
+
+// Get the info applying to the elements of a slice or array
+func (i packerInfo) elem() packerInfo {
+	return packerInfo{order: i.order, zigzag: i.zigzag, intern: i.intern}
 }
 
-type seen []uintptr
+// Pointers, maps and slices currently being encoded, keyed as references
+// are, see refKey
+type seen []refKey
 
-func (s *seen) push(a uintptr) error {
+func (s *seen) push(a refKey) error {
 	for i := len(*s); i > 0; i-- {
 		if (*s)[i-1] == a {
 			return ErrCycle
@@ -42,17 +93,13 @@ func (s *seen) push(a uintptr) error {
 	return nil
 }
 
-func (s *seen) pop() {
-	*s = (*s)[:len(*s)-1]
+func (s *seen) truncate(ln int) {
+	*s = (*s)[:ln]
 }
 
-func parsePackerInfo(tag string, old ...packerInfo) packerInfo {
+func parsePackerInfo(tag string) packerInfo {
 	var info packerInfo
 
-	if len(old) > 0 {
-		info.seen = old[0].seen
-	}
-
 	if tag == "" {
 		return info
 	}
@@ -72,15 +119,247 @@ func parsePackerInfo(tag string, old ...packerInfo) packerInfo {
 		switch key {
 		case "max":
 			info.maxSize, _ = strconv.ParseUint(val, 10, 64)
+			info.rules().rawMax = val
+
+		case "min":
+			info.rules().rawMin = val
+
+		case "nonzero":
+			info.rules().nonzero = true
+
+		case "oneof":
+			info.rules().rawOneOf = val
+
+		case "len":
+			info.rules().rawLen = val
+
+		case "utf8":
+			info.rules().utf8 = true
 
 		case "ignore":
 			info.ignore = true
 
 		case "objects":
 			info.objects = val
+
+		case "fixed", "be":
+			info.order = binary.BigEndian
+
+		case "le":
+			info.order = binary.LittleEndian
+
+		case "zigzag":
+			info.zigzag = true
+
+		case "delta":
+			info.delta = deltaFirst
+
+		case "delta2":
+			info.delta = deltaSecond
+
+		case "intern":
+			info.intern = true
+
+		case "omitempty":
+			info.omitEmpty = true
+
+		case "default":
+			info.defaultValue = val
+			info.hasDefault = true
+
+		case "bits":
+			info.rawBits = val
+			info.hasBits = true
 		}
 
 	}
 
 	return info
 }
+
+// Exported struct field along with its parsed tag
+type fieldInfo struct {
+	index int
+	name  string
+	info  packerInfo
+
+	isFile      bool
+	isInterface bool
+
+	// Number of bit-packed fields in the run starting at this field, 0 if
+	// it is not the first of a run
+	bitRun int
+
+	// Index of the field in the presence bitmap, -1 if it's always present
+	bit int
+
+	// Value the field is left out with if it's optional, zero when invalid,
+	// see fieldInfo.isDefault
+	def reflect.Value
+
+	// The default was set by PackDefaults, decoding keeps the value the hook
+	// sets on the destination instead of sharing def between values
+	hooked bool
+}
+
+// Exported fields of a struct type
+type structInfo struct {
+	fields []fieldInfo
+
+	// Number of fields that may be left out, which is the number of bits in
+	// the presence bitmap
+	optional int
+
+	// The struct implements PackDefaults
+	hooked bool
+
+	// First malformed tag found in the fields, returned whenever the struct
+	// is encoded or decoded
+	err error
+}
+
+// Cache of fields by struct type, tags are only parsed once per type
+var fieldCache sync.Map
+
+func structFields(typ reflect.Type) *structInfo {
+	if st, ok := fieldCache.Load(typ); ok {
+		return st.(*structInfo)
+	}
+
+	var (
+		ln = typ.NumField()
+		st = &structInfo{fields: make([]fieldInfo, 0, ln)}
+
+		// Set by a field such as `_ struct{} pack:"omitempty"`, which makes
+		// every field of the struct optional
+		allOptional bool
+
+		// Values set by PackDefaults, if implemented
+		defaults reflect.Value
+	)
+
+	if reflect.PointerTo(typ).Implements(interfacePackDefaults) {
+		st.hooked = true
+		defaults = reflect.New(typ)
+		defaults.Interface().(PackDefaults).PackDefaults()
+		defaults = defaults.Elem()
+	}
+
+	for i := 0; i < ln; i++ {
+		var field = typ.Field(i)
+
+		if field.Name == "_" && parsePackerInfo(field.Tag.Get("pack")).omitEmpty {
+			allOptional = true
+		}
+	}
+
+	for i := 0; i < ln; i++ {
+		var field = typ.Field(i)
+
+		if !field.IsExported() {
+			continue
+		}
+
+		var (
+			isFile = isFileType(field.Type)
+			info   = parsePackerInfo(field.Tag.Get("pack"))
+		)
+
+		if info.hasBits && !info.ignore {
+			bits, err := strconv.ParseUint(info.rawBits, 10, 8)
+
+			switch {
+			case err != nil:
+			case bits == 0 || bits > 64:
+				err = errors.New("number of bits must be between 1 and 64")
+			case !isBitsKind(field.Type.Kind()):
+				err = errors.New("only booleans and integers may be bit-packed")
+			default:
+				info.bits = uint8(bits)
+			}
+
+			if err != nil && st.err == nil {
+				st.err = &ErrInvalidTag{typ: typ, field: field.Name, tag: "bits:" + info.rawBits, err: err}
+			}
+		}
+
+		var (
+			bit = -1
+			def reflect.Value
+
+			hooked bool
+		)
+
+		if info.hasDefault {
+			var err error
+
+			def, err = parseTagValue(field.Type, info.defaultValue)
+			if err != nil && st.err == nil {
+				st.err = &ErrInvalidTag{typ: typ, field: field.Name, tag: "default:" + info.defaultValue, err: err}
+			}
+		} else if defaults.IsValid() && !defaults.Field(i).IsZero() {
+			def = defaults.Field(i)
+			hooked = true
+		}
+
+		if info.delta != deltaNone {
+			if err := checkDeltaTag(field.Type); err != nil && st.err == nil {
+				tag := "delta"
+				if info.delta == deltaSecond {
+					tag = "delta2"
+				}
+
+				st.err = &ErrInvalidTag{typ: typ, field: field.Name, tag: tag, err: err}
+			}
+		}
+
+		if info.validate != nil {
+			tag, err := info.validate.compile(field.Type)
+			if err != nil && st.err == nil {
+				st.err = &ErrInvalidTag{typ: typ, field: field.Name, tag: tag, err: err}
+			}
+
+			if info.validate.empty() {
+				info.validate = nil
+			}
+		}
+
+		// Bit-packed fields are already smaller than their presence bit
+		if (info.omitEmpty || allOptional) && !info.ignore && info.bits == 0 {
+			bit = st.optional
+			st.optional++
+		}
+
+		st.fields = append(st.fields, fieldInfo{
+			index: i,
+			name:  field.Name,
+			info:  info,
+
+			isFile:      isFile,
+			isInterface: field.Type.Kind() == reflect.Interface && !isFile,
+
+			bit: bit,
+			def: def,
+
+			hooked: hooked,
+		})
+	}
+
+	var fields = st.fields
+
+	for i := len(fields) - 1; i >= 0; i-- {
+		if fields[i].info.bits == 0 {
+			continue
+		}
+
+		fields[i].bitRun = 1
+		if i+1 < len(fields) && fields[i+1].bitRun > 0 {
+			fields[i].bitRun += fields[i+1].bitRun
+			fields[i+1].bitRun = 0
+		}
+	}
+
+	cached, _ := fieldCache.LoadOrStore(typ, st)
+
+	return cached.(*structInfo)
+}
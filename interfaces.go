@@ -19,3 +19,16 @@ type AfterUnpack interface {
 }
 
 var interfaceAfterUnpack = reflect.TypeOf((*AfterUnpack)(nil)).Elem()
+
+type PackDefaults interface {
+	// If a struct implements this interface, this function will be called
+	// right before its fields are unpacked, so optional fields that are
+	// absent from the data keep the values it sets.
+	//
+	// It's also called once per type when the struct is first met, to find
+	// out which values optional fields may be left out with, so it must
+	// always set the same values.
+	PackDefaults()
+}
+
+var interfacePackDefaults = reflect.TypeOf((*PackDefaults)(nil)).Elem()
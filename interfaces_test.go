@@ -1,6 +1,7 @@
 package pack
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -70,3 +71,76 @@ func TestAfterUnpack(t *testing.T) {
 		t.Errorf("expected method output.AfterUnpack() to be called after object unpacking")
 	}
 }
+
+type objectPackDefaults struct {
+	Val   string         `pack:"omitempty"`
+	Attrs map[string]int `pack:"omitempty"`
+	Other int            `pack:"omitempty"`
+}
+
+func (a *objectPackDefaults) PackDefaults() {
+	a.Val = "Hello, World!"
+	a.Attrs = map[string]int{"a": 1}
+}
+
+func TestPackDefaults(t *testing.T) {
+
+	t.Parallel()
+
+	var inputs = []objectPackDefaults{
+		{Val: "Hello, World!", Attrs: map[string]int{"a": 1}},
+		{Val: "", Attrs: nil, Other: 1},
+		{Val: "Bye", Attrs: map[string]int{"b": 2}},
+	}
+
+	for _, input := range inputs {
+		var output objectPackDefaults
+
+		data, err := Marshal(input)
+		if err != nil {
+			t.Error(err)
+		}
+
+		err = Unmarshal(data, &output)
+		if err != nil {
+			t.Error(err)
+		}
+
+		if !reflect.DeepEqual(input, output) {
+			t.Errorf("expected %+v, got %+v", input, output)
+		}
+	}
+
+	// Fields holding the values set by PackDefaults are left out
+	if data, _ := Marshal(inputs[0]); len(data) != 1 {
+		t.Errorf("expected struct holding its defaults to only take its presence bitmap, got %d bytes", len(data))
+	}
+
+	// Absent fields PackDefaults does not set are zeroed, not kept
+	output := objectPackDefaults{Val: "Old", Attrs: map[string]int{"old": 0}, Other: 5}
+
+	if err := Unmarshal([]byte{0}, &output); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(output, inputs[0]) {
+		t.Errorf("expected absent fields to decode as their defaults when decoding into a non-zero value, got %+v", output)
+	}
+
+	// Defaults set by PackDefaults are not shared between decoded values
+	var x, y objectPackDefaults
+
+	if err := Unmarshal([]byte{0}, &x); err != nil {
+		t.Fatal(err)
+	}
+
+	x.Attrs["b"] = 2
+
+	if err := Unmarshal([]byte{0}, &y); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(y.Attrs, map[string]int{"a": 1}) {
+		t.Errorf("expected changes to a decoded default not to show up in the next decoded value, got %+v", y.Attrs)
+	}
+}
@@ -0,0 +1,80 @@
+package pack
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+var typeString = reflect.TypeOf("")
+
+// Encode a string through the string table of the current top-level object,
+// the first occurrence is written inline after a header of len<<1 and takes
+// the next ID, later ones are written as a header of id<<1|1
+func (p *packer) encodeInterned(str string, info packerInfo) error {
+	var ln = uint64(len(str))
+
+	// Checked for back-references too, as the decoder does
+	if info.maxSize > 0 && ln > info.maxSize {
+		return &ErrDataTooLarge{typ: typeString, max: info.maxSize, size: ln}
+	}
+
+	if id, ok := p.interned[str]; ok {
+		return p.writeVarUint(id<<1 | 1)
+	}
+
+	if p.stopat > 0 && p.written+ln > p.stopat {
+		return &ErrDataTooLarge{max: p.sizelimit, size: p.written + ln}
+	}
+
+	if p.interned == nil {
+		p.interned = map[string]uint64{}
+	}
+
+	p.interned[str] = uint64(len(p.interned))
+
+	err := p.writeVarUint(ln << 1)
+	if err != nil {
+		return err
+	}
+
+	return p.write(unsafe.Slice(unsafe.StringData(str), len(str)))
+}
+
+// Decode a string encoded with encodeInterned, repeated strings share the
+// memory of their first occurrence
+func (u *unpacker) decodeInterned(info packerInfo) (string, error) {
+	var header uint64
+
+	n, err := ReadVarUint(u.reader, &header, u.buffer[:])
+	u.read += uint64(n)
+	if err != nil {
+		return "", err
+	}
+
+	if header&1 == 1 {
+		id := header >> 1
+
+		if id >= uint64(len(u.interned)) {
+			return "", ErrInvalidReference
+		}
+
+		str := u.interned[id]
+
+		if info.maxSize > 0 && uint64(len(str)) > info.maxSize {
+			return "", &ErrDataTooLarge{typ: typeString, max: info.maxSize, size: uint64(len(str))}
+		}
+
+		return str, nil
+	}
+
+	buf, err := u.decodeBytes(header>>1, info, nil)
+	if err != nil {
+		return "", err
+	}
+
+	str := *(*string)(unsafe.Pointer(&buf))
+
+	u.interned = append(u.interned, str)
+
+	return str, nil
+}
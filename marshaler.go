@@ -1,20 +1,68 @@
 package pack
 
-import "bytes"
-
 // Pack object into bytes
 func Marshal(data any, options ...Options) ([]byte, error) {
-	var buf = bytes.NewBuffer(nil)
+	return AppendMarshal(nil, data, options...)
+}
+
+// Pack object, appending it to dst and returning the extended buffer
+//
+// Packers are pooled, so no allocations are made for flat structs once dst
+// has enough capacity. On error, dst is returned unchanged
+func AppendMarshal(dst []byte, data any, options ...Options) ([]byte, error) {
+	p := packerPool.Get().(*packer)
+
+	p.setOptions(options)
+	p.appender.buf = dst
+	p.Reset(&p.appender)
+
+	err := p.Encode(data)
+
+	buf := p.appender.buf
+
+	// Do not keep references to user data in the pool
+	p.appender.buf = nil
+	p.Reset(nil)
+	p.release()
+	p.setOptions(nil)
+	packerPool.Put(p)
+
+	if err != nil {
+		return dst, err
+	}
+
+	return buf, nil
+}
+
+// Get the exact amount of bytes Marshal would produce for data, without
+// encoding it
+//
+// Errors, including ErrDataTooLarge, are the same Marshal would return, and
+// BeforePack is called as it would be by Marshal
+func Size(data any, options ...Options) (int, error) {
+	p := packerPool.Get().(*packer)
+
+	p.setOptions(options)
+	p.Reset(nil)
+	p.sizing = true
+
+	err := p.Encode(data)
+
+	size := p.written
+
+	p.sizing = false
+	p.release()
+	p.setOptions(nil)
+	packerPool.Put(p)
 
-	err := NewPacker(buf, options...).Encode(data)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 
-	return buf.Bytes(), nil
+	return int(size), nil
 }
 
 // Unpack object from bytes
 func Unmarshal(b []byte, data any, options ...Options) error {
-	return NewUnpacker(bytes.NewBuffer(b), options...).Decode(data)
+	return NewUnpacker(&sliceReader{buf: b}, options...).Decode(data)
 }
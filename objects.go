@@ -61,3 +61,14 @@ func (o *objects) Push(items ...any) Objects {
 
 	return o
 }
+
+// Get the ID of the type of val, without boxing it for the Objects
+// implemented here
+func objectID(o Objects, val reflect.Value) (uint, bool) {
+	if o, ok := o.(*objects); ok {
+		id, ok := o.typeToId[val.Type()]
+		return id, ok
+	}
+
+	return o.GetID(val.Interface())
+}
@@ -20,4 +20,82 @@ type Options struct {
 	// Once the limit is about to be passed, an error of type ErrDataTooLarge will
 	// be returned.
 	SizeLimit uint64
+
+	// Decode directly from the input of Unmarshal, so decoded strings and
+	// []byte values alias the input instead of being copied out of it.
+	//
+	// The caller must keep the input alive and unmodified for as long as any
+	// decoded value is in use, as modifying it modifies them too.
+	//
+	// Only used by Unmarshal
+	ZeroCopy bool
+
+	// Encode signed integers with ZigZag encoding instead of as VarInts, as
+	// protobuf does for sint64, so other ecosystems may decode them with
+	// their own varint decoders; see PutZigZag.
+	//
+	// May also be set per field by tagging it with `pack:"zigzag"`
+	ZigZag bool
+
+	// Encode every string through a table kept for each top-level object, so
+	// repeated strings such as map keys and enum-like values are written in
+	// full only once and as a short back-reference afterwards, decoded
+	// strings share the memory of their first occurrence.
+	//
+	// May also be set per field by tagging it with `pack:"intern"`, which
+	// applies to the strings held in its slices, arrays and maps too
+	Intern bool
+
+	// Decode into the existing contents of the value given to Decode instead
+	// of allocating new ones: slices with enough capacity are truncated and
+	// refilled, non-nil maps are cleared and refilled, and non-nil pointers
+	// are decoded into the value they point to.
+	//
+	// Useful to reach near-zero allocations when decoding into the same value
+	// in a loop, values previously decoded may not be kept around as they are
+	// overwritten by the next Decode
+	Reuse bool
+
+	// Encode pointers, maps and slices met more than once in a top-level
+	// object as references to their first occurrence, so values shared by
+	// several fields decode as shared values and cyclic structures such as
+	// trees with parent links decode with their cycles intact, instead of
+	// being cut with a nil pointer.
+	//
+	// Slices are only shared when they have the same start and length.
+	// Top-level objects and Objects in interfaces count as shared values
+	// too, when given as pointers
+	PreserveReferences bool
+
+	// What to do when a pointer leads back to a value that is being encoded,
+	// see CyclePolicy (default: CycleTruncate)
+	CyclePolicy CyclePolicy
+
+	// Capacity of the channel returned by Socket.Incoming, once full the
+	// internal reader stops reading from the connection until there is room
+	// again (default: 16)
+	//
+	// Only used by Socket
+	IncomingBuffer int
+
+	// Optional collector of per message type statistics, keyed by the Object
+	// IDs in WithObjects, Sockets without one do not measure anything
+	//
+	// Only used by Socket
+	WithStats StatsCollector
 }
+
+type CyclePolicy int
+
+const (
+	// Cut cycles by encoding the pointer or map closing them as nil, or the
+	// slice closing them as empty
+	CycleTruncate CyclePolicy = iota
+
+	// Fail to encode cycles with an error of type ErrCycleAt, which holds the
+	// field path of the pointer, map or slice closing them
+	CycleError
+
+	// Keep cycles as references, same as Options.PreserveReferences
+	CyclePreserve
+)
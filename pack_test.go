@@ -2,9 +2,16 @@ package pack
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"io"
+	"math"
 	"reflect"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
+	"unsafe"
 )
 
 func TestPack(t *testing.T) {
@@ -143,7 +150,7 @@ func TestPack(t *testing.T) {
 		packer.written = 0
 		unpacker.read = 0
 
-		err := packer.encode(input, packerInfo{})
+		err := packer.encode(reflect.ValueOf(input), packerInfo{})
 		if err != nil {
 			t.Error(err)
 		}
@@ -209,6 +216,960 @@ func TestIgnore(t *testing.T) {
 	}
 }
 
+func TestFixed(t *testing.T) {
+
+	t.Parallel()
+
+	type object struct {
+		Hash    uint64     `pack:"fixed"`
+		ID      int32      `pack:"le"`
+		Neg     int16      `pack:"be"`
+		Int     int        `pack:"le"`
+		Float   float32    `pack:"le"`
+		Complex complex128 `pack:"le"`
+		Words   []uint32   `pack:"le"`
+		Array   [2]int64   `pack:"fixed"`
+		Ptr     *uint16    `pack:"le"`
+		Varint  uint64
+	}
+
+	var (
+		word uint16 = 0xbeef
+
+		src = object{
+			Hash:    0x0102030405060708,
+			ID:      -2,
+			Neg:     -300,
+			Int:     1,
+			Float:   1.5,
+			Complex: complex(1, -1),
+			Words:   []uint32{1, 0xdeadbeef},
+			Array:   [2]int64{-1, 2},
+			Ptr:     &word,
+			Varint:  1,
+		}
+
+		expected = []byte{
+			1, 2, 3, 4, 5, 6, 7, 8, // Hash
+			0xfe, 0xff, 0xff, 0xff, // ID
+			0xfe, 0xd4, // Neg
+			1, 0, 0, 0, 0, 0, 0, 0, // Int
+			0, 0, 0xc0, 0x3f, // Float
+			0, 0, 0, 0, 0, 0, 0xf0, 0x3f, 0, 0, 0, 0, 0, 0, 0xf0, 0xbf, // Complex
+			2, 1, 0, 0, 0, 0xef, 0xbe, 0xad, 0xde, // Words
+			0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0, 0, 0, 0, 2, // Array
+			1, 0xef, 0xbe, // Ptr
+			1, // Varint
+		}
+
+		dst object
+	)
+
+	data, err := Marshal(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(data, expected) {
+		t.Errorf("expected fixed width fields to encode as %x, got %x", expected, data)
+	}
+
+	err = Unmarshal(data, &dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(src, dst) {
+		t.Errorf("expected %+v, got %+v", src, dst)
+	}
+
+	size, err := Size(src)
+	if err != nil || size != len(expected) {
+		t.Errorf("expected Size to return %d, got %d, %v", len(expected), size, err)
+	}
+}
+
+func TestZigZagTag(t *testing.T) {
+
+	t.Parallel()
+
+	type object struct {
+		Tagged  int64   `pack:"zigzag"`
+		Slice   []int32 `pack:"zigzag"`
+		Default int
+	}
+
+	var (
+		src = object{
+			Tagged:  -150,
+			Slice:   []int32{-1, 1},
+			Default: -1,
+		}
+
+		tests = []struct {
+			options  Options
+			expected []byte
+		}{
+			{Options{}, []byte{0xab, 0x02, 2, 0x01, 0x02, 0x41}},
+			{Options{ZigZag: true}, []byte{0xab, 0x02, 2, 0x01, 0x02, 0x01}},
+		}
+	)
+
+	for _, test := range tests {
+		var dst object
+
+		data, err := Marshal(src, test.options)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(data, test.expected) {
+			t.Errorf("expected %+v to encode as %x, got %x", test.options, test.expected, data)
+		}
+
+		err = Unmarshal(data, &dst, test.options)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(src, dst) {
+			t.Errorf("expected %+v, got %+v", src, dst)
+		}
+	}
+}
+
+func TestDelta(t *testing.T) {
+
+	t.Parallel()
+
+	type object struct {
+		Timestamps []int64  `pack:"delta2"`
+		Counters   []uint32 `pack:"delta"`
+		Extremes   []int64  `pack:"delta"`
+		Small      []int8   `pack:"delta;zigzag"`
+		Array      [3]int16 `pack:"delta;le"`
+		Limited    []int    `pack:"delta;max:2"`
+	}
+
+	var (
+		timestamps = make([]int64, 100)
+
+		src = object{
+			Timestamps: timestamps,
+			Counters:   []uint32{10, 5, math.MaxUint32, 0},
+			Extremes:   []int64{math.MinInt64, math.MaxInt64, 0, math.MinInt64},
+			Small:      []int8{-128, 127, 0},
+			Array:      [3]int16{1000, 1001, -1000},
+			Limited:    []int{1, 2},
+		}
+
+		dst object
+	)
+
+	for i := range timestamps {
+		timestamps[i] = 1_700_000_000_000 + int64(i)*1000
+	}
+
+	data, err := Marshal(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Unmarshal(data, &dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(src, dst) {
+		t.Errorf("expected %+v, got %+v", src, dst)
+	}
+
+	plain, err := Marshal(timestamps)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encoded, err := Marshal(object{Timestamps: timestamps})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first two timestamps take full varints, the rest are all 0
+	if len(encoded) >= len(plain)/4 {
+		t.Errorf("expected delta2 timestamps to take less than %d bytes, got %d", len(plain)/4, len(encoded))
+	}
+
+	size, err := Size(src)
+	if err != nil || size != len(data) {
+		t.Errorf("expected Size to return %d, got %d, %v", len(data), size, err)
+	}
+
+	_, err = Marshal(object{Limited: []int{1, 2, 3}})
+	if !reflect.DeepEqual(err, &ErrDataTooLarge{typ: reflect.TypeOf([]int{}), max: 2, size: 3}) {
+		t.Errorf("expected delta encoded slice over max to return ErrDataTooLarge, got %v", err)
+	}
+
+	type unlimited struct {
+		Timestamps []int64  `pack:"delta2"`
+		Counters   []uint32 `pack:"delta"`
+		Extremes   []int64  `pack:"delta"`
+		Small      []int8   `pack:"delta;zigzag"`
+		Array      [3]int16 `pack:"delta;le"`
+		Limited    []int    `pack:"delta"`
+	}
+
+	data, err = Marshal(unlimited{Limited: []int{1, 2, 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dataTooLarge *ErrDataTooLarge
+
+	err = Unmarshal(data, &dst)
+	if !errors.As(err, &dataTooLarge) {
+		t.Errorf("expected decoding delta encoded slice over max to return ErrDataTooLarge, got %v", err)
+	}
+
+	var invalidTag *ErrInvalidTag
+
+	for _, input := range []any{
+		&struct {
+			Data []byte `pack:"delta"`
+		}{},
+		&struct {
+			Flags []bool `pack:"delta2"`
+		}{},
+		&struct {
+			Value int `pack:"delta"`
+		}{},
+	} {
+		if _, err := Marshal(input); !errors.As(err, &invalidTag) {
+			t.Errorf("expected encoding %T to return ErrInvalidTag, got %v", input, err)
+		}
+	}
+}
+
+func TestBits(t *testing.T) {
+
+	t.Parallel()
+
+	type color uint8
+
+	type object struct {
+		Flag   bool  `pack:"bits:1"`
+		Color  color `pack:"bits:3"`
+		Offset int   `pack:"bits:5"`
+		Name   string
+		Level  int8   `pack:"bits:2"`
+		Wide   uint64 `pack:"bits:64"`
+	}
+
+	var (
+		src = object{
+			Flag:   true,
+			Color:  5,
+			Offset: -16,
+			Name:   "bits",
+			Level:  1,
+			Wide:   math.MaxUint64,
+		}
+
+		dst object
+	)
+
+	data, err := Marshal(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Unmarshal(data, &dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(src, dst) {
+		t.Errorf("expected %+v, got %+v", src, dst)
+	}
+
+	// Flag, Color and Offset share 2 bytes, Level and Wide share 9, Name takes 5
+	if len(data) != 16 {
+		t.Errorf("expected bit-packed struct to take 16 bytes, got %d", len(data))
+	}
+
+	size, err := Size(src)
+	if err != nil || size != len(data) {
+		t.Errorf("expected Size to return %d, got %d, %v", len(data), size, err)
+	}
+
+	for _, input := range []object{{Color: 8}, {Offset: 16}, {Offset: -17}, {Level: -3}} {
+		var outOfRange *ErrOutOfRange
+
+		_, err = Marshal(input)
+		if !errors.As(err, &outOfRange) {
+			t.Errorf("expected encoding %+v to return ErrOutOfRange, got %v", input, err)
+		}
+	}
+
+	type wider struct {
+		Value uint16 `pack:"bits:12"`
+	}
+
+	type narrower struct {
+		Value uint8 `pack:"bits:12"`
+	}
+
+	data, err = Marshal(wider{Value: 300})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var outOfRange *ErrOutOfRange
+
+	err = Unmarshal(data, &narrower{})
+	if !errors.As(err, &outOfRange) {
+		t.Errorf("expected decoding a value too large for the field to return ErrOutOfRange, got %v", err)
+	}
+
+	type ignored struct {
+		First  bool  `pack:"bits:1"`
+		Hidden uint8 `pack:"ignore;bits:3"`
+		Last   bool  `pack:"bits:1"`
+	}
+
+	data, err = Marshal(ignored{First: true, Hidden: 5, Last: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded ignored
+
+	if err = Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded != (ignored{First: true, Last: true}) {
+		t.Errorf("expected ignored field to be left out of the bitstream, got %+v", decoded)
+	}
+
+	var invalidTag *ErrInvalidTag
+
+	for _, input := range []any{
+		&struct {
+			Value uint8 `pack:"bits:0"`
+		}{},
+		&struct {
+			Value uint64 `pack:"bits:65"`
+		}{},
+		&struct {
+			Value uint8 `pack:"bits:three"`
+		}{},
+		&struct {
+			Value string `pack:"bits:3"`
+		}{},
+	} {
+		if _, err := Marshal(input); !errors.As(err, &invalidTag) {
+			t.Errorf("expected encoding %T to return ErrInvalidTag, got %v", input, err)
+		}
+	}
+}
+
+func TestIntern(t *testing.T) {
+
+	t.Parallel()
+
+	type entry struct {
+		Kind  string            `pack:"intern"`
+		Attrs map[string]string `pack:"intern"`
+		Note  string
+	}
+
+	type plainEntry struct {
+		Kind  string
+		Attrs map[string]string
+		Note  string
+	}
+
+	var (
+		src      = make([]entry, 100)
+		dst      []entry
+		untagged = make([]plainEntry, len(src))
+	)
+
+	for i := range src {
+		src[i] = entry{
+			Kind:  "measurement",
+			Attrs: map[string]string{"region": "eu-west", "unit": "celsius"},
+			Note:  "note",
+		}
+
+		untagged[i] = plainEntry(src[i])
+	}
+
+	plain, err := Marshal(untagged)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, options := range []Options{{}, {Intern: true}} {
+		data, err := Marshal(src, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(data) >= len(plain)/2 {
+			t.Errorf("expected interned data to take less than %d bytes, got %d", len(plain)/2, len(data))
+		}
+
+		err = Unmarshal(data, &dst, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(src, dst) {
+			t.Errorf("expected %+v, got %+v", src, dst)
+		}
+
+		if unsafe.StringData(dst[0].Kind) != unsafe.StringData(dst[1].Kind) {
+			t.Errorf("expected repeated strings to share memory")
+		}
+
+		size, err := Size(src, options)
+		if err != nil || size != len(data) {
+			t.Errorf("expected Size to return %d, got %d, %v", len(data), size, err)
+		}
+	}
+
+	// Every top-level object starts with an empty table
+	var (
+		buf = bytes.NewBuffer(nil)
+
+		packer   = NewPacker(buf, Options{Intern: true})
+		unpacker = NewUnpacker(buf, Options{Intern: true})
+	)
+
+	for i := 0; i < 2; i++ {
+		err = packer.Encode("repeated")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		var str string
+
+		err = unpacker.Decode(&str)
+		if err != nil || str != "repeated" {
+			t.Errorf("expected to decode \"repeated\", got %q, %v", str, err)
+		}
+	}
+
+	var str string
+
+	err = Unmarshal([]byte{0x01}, &str, Options{Intern: true})
+	if err != ErrInvalidReference {
+		t.Errorf("expected reference to an unknown string to return ErrInvalidReference, got %v", err)
+	}
+
+	type limited struct {
+		A string
+		B string `pack:"max:2"`
+	}
+
+	var dataTooLarge *ErrDataTooLarge
+
+	_, err = Marshal(limited{A: "long", B: "long"}, Options{Intern: true})
+	if !errors.As(err, &dataTooLarge) {
+		t.Errorf("expected repeated string over max to return ErrDataTooLarge, got %v", err)
+	}
+}
+
+func TestPreserveReferences(t *testing.T) {
+
+	t.Parallel()
+
+	type node struct {
+		Name     string
+		Parent   *node
+		Children []*node
+		Attrs    map[string]int
+		Tags     []string
+	}
+
+	var (
+		attrs = map[string]int{"depth": 1}
+		tags  = []string{"leaf"}
+
+		root = &node{Name: "root"}
+
+		options = Options{PreserveReferences: true}
+
+		dst *node
+	)
+
+	for _, name := range []string{"a", "b"} {
+		root.Children = append(root.Children, &node{Name: name, Parent: root, Attrs: attrs, Tags: tags})
+	}
+
+	data, err := Marshal(root, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Unmarshal(data, &dst, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dst.Children) != 2 || dst.Children[0].Name != "a" || dst.Children[1].Name != "b" {
+		t.Fatalf("expected root with children a and b, got %+v", dst)
+	}
+
+	var a, b = dst.Children[0], dst.Children[1]
+
+	if a.Parent != dst || b.Parent != dst {
+		t.Errorf("expected parent links to point back to the decoded root")
+	}
+
+	a.Attrs["depth"] = 2
+	if b.Attrs["depth"] != 2 {
+		t.Errorf("expected shared maps to decode as the same map")
+	}
+
+	if &a.Tags[0] != &b.Tags[0] {
+		t.Errorf("expected shared slices to decode with the same backing array")
+	}
+
+	size, err := Size(root, options)
+	if err != nil || size != len(data) {
+		t.Errorf("expected Size to return %d, got %d, %v", len(data), size, err)
+	}
+
+	// Without the option, the cycle is cut and shared values are copied
+	data, err = Marshal(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Unmarshal(data, &dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dst.Children[0].Parent != nil {
+		t.Errorf("expected parent links to be cut without PreserveReferences, got %+v", dst.Children[0].Parent)
+	}
+
+	// Objects are registered too, so a cycle may close on the root
+	var (
+		objects = Options{WithObjects: NewObjects(node{}), PreserveReferences: true}
+
+		obj any
+	)
+
+	data, err = Marshal(root, objects)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Unmarshal(data, &obj, objects)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dst, ok := obj.(*node); !ok || len(dst.Children) != 2 || dst.Children[0].Parent != dst {
+		t.Errorf("expected parent links to point back to the decoded root object, got %+v", obj)
+	}
+
+	// A root given by value is encoded again when referenced, its slices
+	// may be referenced before they are fully decoded
+	data, err = Marshal(*root, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var value node
+
+	err = Unmarshal(data, &value, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if parent := value.Children[0].Parent; parent == nil || &parent.Children[0] != &value.Children[0] {
+		t.Errorf("expected the copy of the root to share its children with the decoded root")
+	}
+
+	var ptrs []*int
+
+	// Slice with ID 0 holding a pointer with ID 1, then a reference to ID 2
+	err = Unmarshal([]byte{refNew, 2, refNew, 0, refFirstID + 2}, &ptrs, options)
+	if err != ErrInvalidReference {
+		t.Errorf("expected reference to an unknown value to return ErrInvalidReference, got %v", err)
+	}
+}
+
+func TestCyclePolicy(t *testing.T) {
+
+	t.Parallel()
+
+	type node struct {
+		Name     string
+		Parent   *node
+		Children map[string][]*node
+	}
+
+	var (
+		root  = &node{Name: "root"}
+		child = &node{Name: "child", Parent: root}
+	)
+
+	root.Children = map[string][]*node{"left": {child}}
+
+	_, err := Marshal(root, Options{CyclePolicy: CycleError})
+	if !errors.Is(err, ErrCycle) {
+		t.Fatalf("expected CycleError to return ErrCycle, got %v", err)
+	}
+
+	if expected := "circular reference detected at .Children[left][0].Parent"; err.Error() != expected {
+		t.Errorf("expected error %q, got %q", expected, err.Error())
+	}
+
+	var dst *node
+
+	for _, policy := range []CyclePolicy{CycleTruncate, CyclePreserve} {
+		options := Options{CyclePolicy: policy}
+
+		data, err := Marshal(root, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = Unmarshal(data, &dst, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var parent = dst.Children["left"][0].Parent
+
+		if policy == CycleTruncate && parent != nil {
+			t.Errorf("expected CycleTruncate to cut the cycle, got %+v", parent)
+		}
+
+		if policy == CyclePreserve && parent != dst {
+			t.Errorf("expected CyclePreserve to keep the cycle, got %+v", parent)
+		}
+	}
+
+	var leaf = &node{Name: "leaf"}
+
+	_, err = Marshal(&node{Children: map[string][]*node{"left": {leaf}, "right": {leaf}}}, Options{CyclePolicy: CycleError})
+	if err != nil {
+		t.Errorf("expected shared values without a cycle to encode with CycleError, got %v", err)
+	}
+
+	// Maps and slices containing themselves through interfaces
+	var (
+		selfMap   = map[string]any{}
+		selfSlice = []any{nil, 1}
+	)
+
+	selfMap["x"] = selfMap
+	selfSlice[0] = selfSlice
+
+	for _, input := range []any{selfMap, selfSlice} {
+		_, err = Marshal(input, Options{CyclePolicy: CycleError})
+		if !errors.Is(err, ErrCycle) {
+			t.Errorf("expected CycleError to return ErrCycle for %T containing itself, got %v", input, err)
+		}
+
+		_, err = Marshal(input)
+		if err != nil {
+			t.Errorf("expected CycleTruncate to cut %T containing itself, got %v", input, err)
+		}
+	}
+
+	if _, err = Marshal(selfMap, Options{CyclePolicy: CycleError}); err == nil || err.Error() != "circular reference detected at [x]" {
+		t.Errorf("expected cycle to be reported at [x], got %v", err)
+	}
+}
+
+func TestOmitEmpty(t *testing.T) {
+
+	t.Parallel()
+
+	type event struct {
+		ID      int
+		Name    string            `pack:"omitempty"`
+		Tags    []string          `pack:"omitempty"`
+		Attrs   map[string]string `pack:"omitempty"`
+		Parent  *int              `pack:"omitempty"`
+		Payload any               `pack:"omitempty"`
+	}
+
+	type config struct {
+		_ struct{} `pack:"omitempty"`
+
+		A, B, C, D, E, F, G, H, I int
+	}
+
+	var (
+		parent = 7
+
+		inputs = []any{
+			event{ID: 1},
+			event{ID: 2, Name: "name", Parent: &parent},
+			event{ID: 3, Tags: []string{"a"}, Attrs: map[string]string{"k": "v"}, Payload: "payload"},
+			config{},
+			config{B: 2, I: 9},
+		}
+	)
+
+	for _, input := range inputs {
+		data, err := Marshal(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Start from a value with every field set, absent fields must be zeroed
+		var dst = reflect.New(reflect.TypeOf(input))
+
+		switch dst := dst.Interface().(type) {
+		case *event:
+			*dst = event{ID: -1, Name: "stale", Tags: []string{"stale"}, Parent: new(int), Payload: 1}
+		case *config:
+			*dst = config{A: -1, B: -1, C: -1, D: -1, E: -1, F: -1, G: -1, H: -1, I: -1}
+		}
+
+		err = Unmarshal(data, dst.Interface())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(input, dst.Elem().Interface()) {
+			t.Errorf("expected %+v, got %+v", input, dst.Elem().Interface())
+		}
+
+		size, err := Size(input)
+		if err != nil || size != len(data) {
+			t.Errorf("expected Size to return %d, got %d, %v", len(data), size, err)
+		}
+	}
+
+	// A presence bitmap of 2 bytes for 9 fields, 1 byte for B and 1 for I
+	if data, _ := Marshal(config{B: 2, I: 9}); len(data) != 4 {
+		t.Errorf("expected sparse struct to take 4 bytes, got %d", len(data))
+	}
+}
+
+func TestDefaults(t *testing.T) {
+
+	t.Parallel()
+
+	type config struct {
+		_       struct{}      `pack:"omitempty"`
+		Name    string        `pack:"default:server"`
+		Port    uint16        `pack:"default:8080"`
+		Mask    int32         `pack:"default:0x7f"`
+		Ratio   float64       `pack:"default:0.5"`
+		Verbose bool          `pack:"default:true"`
+		Timeout time.Duration `pack:"default:1m30s"`
+		Plain   int           `pack:"omitempty"`
+	}
+
+	var inputs = []config{
+		{Name: "server", Port: 8080, Mask: 0x7f, Ratio: 0.5, Verbose: true, Timeout: 90 * time.Second},
+		{},
+		{Name: "other", Port: 1, Verbose: false, Timeout: time.Second, Plain: 1},
+	}
+
+	for _, input := range inputs {
+		var output config
+
+		data, err := Marshal(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = Unmarshal(data, &output)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(input, output) {
+			t.Errorf("expected %+v, got %+v", input, output)
+		}
+	}
+
+	// Absent fields decode as their default
+	var output config
+
+	err := Unmarshal([]byte{0}, &output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(output, inputs[0]) {
+		t.Errorf("expected absent fields to decode as their defaults, got %+v", output)
+	}
+
+	// Without omitempty a default does not change how the field is packed
+	type required struct {
+		Port uint16 `pack:"default:8080"`
+	}
+
+	type untagged struct {
+		Port uint16
+	}
+
+	tagged, err := Marshal(required{Port: 8080})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plain, err := Marshal(untagged{Port: 8080})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(tagged, plain) {
+		t.Errorf("expected a default alone to keep the field always present, got %v instead of %v", tagged, plain)
+	}
+
+	type malformed struct {
+		Port uint8 `pack:"default:300"`
+	}
+
+	var invalidTag *ErrInvalidTag
+
+	_, err = Marshal(malformed{})
+	if !errors.As(err, &invalidTag) || !errors.Is(err, strconv.ErrRange) {
+		t.Errorf("expected default out of range to return ErrInvalidTag, got %v", err)
+	}
+
+	err = Unmarshal([]byte{0}, &malformed{})
+	if !errors.As(err, &invalidTag) {
+		t.Errorf("expected decoding with a malformed default to return ErrInvalidTag, got %v", err)
+	}
+
+	type unsupported struct {
+		Tags []string `pack:"default:a"`
+	}
+
+	_, err = Marshal(unsupported{})
+	if !errors.As(err, &invalidTag) {
+		t.Errorf("expected default on a slice to return ErrInvalidTag, got %v", err)
+	}
+}
+
+func TestValidation(t *testing.T) {
+
+	t.Parallel()
+
+	type user struct {
+		Name  string   `pack:"len:1-16;utf8"`
+		Age   *int     `pack:"min:0;max:150"`
+		Role  string   `pack:"oneof:admin|user"`
+		Level uint8    `pack:"oneof:1|2|3"`
+		Score float64  `pack:"min:-1;max:1"`
+		Token []byte   `pack:"nonzero;utf8"`
+		Tags  []string `pack:"len:0-2;max:5"`
+		Flags uint8    `pack:"bits:4;min:3"`
+		Mode  uint8    `pack:"bits:4;oneof:1|2"`
+	}
+
+	type team struct {
+		Members map[string][]user
+	}
+
+	var (
+		age = 30
+
+		valid = user{Name: "gopher", Age: &age, Role: "admin", Level: 2, Score: 0.5, Token: []byte("token"), Tags: []string{"a"}, Flags: 3, Mode: 1}
+	)
+
+	for _, test := range []struct {
+		mutate func(*user)
+		rule   string
+		value  any
+	}{
+		{func(u *user) {}, "", nil},
+		{func(u *user) { u.Age = nil }, "", nil},
+		{func(u *user) { u.Name = "" }, "len:1-16", ""},
+		{func(u *user) { u.Name = "\xff" }, "utf8", "\xff"},
+		{func(u *user) { *u.Age = -1 }, "min:0", -1},
+		{func(u *user) { *u.Age = 151 }, "max:150", 151},
+		{func(u *user) { u.Role = "root" }, "oneof:admin|user", "root"},
+		{func(u *user) { u.Level = 4 }, "oneof:1|2|3", uint8(4)},
+		{func(u *user) { u.Score = math.NaN() }, "min:-1", math.NaN()},
+		{func(u *user) { u.Token = nil }, "nonzero", []byte(nil)},
+		{func(u *user) { u.Tags = []string{"a", "b", "c"} }, "len:0-2", []string{"a", "b", "c"}},
+		{func(u *user) { u.Flags = 1 }, "min:3", uint8(1)},
+		{func(u *user) { u.Mode = 9 }, "oneof:1|2", uint8(9)},
+	} {
+		var (
+			input = valid
+			age   = *valid.Age
+		)
+
+		input.Age = &age
+		test.mutate(&input)
+
+		data, err := Marshal(team{Members: map[string][]user{"core": {valid, input}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var output team
+
+		err = Unmarshal(data, &output)
+
+		if test.rule == "" {
+			if err != nil {
+				t.Errorf("expected %+v to be valid, got %v", input, err)
+			}
+			continue
+		}
+
+		var validation *ErrValidation
+		if !errors.As(err, &validation) {
+			t.Errorf("expected %+v to return ErrValidation, got %v", input, err)
+			continue
+		}
+
+		if validation.Rule() != test.rule || !strings.HasPrefix(validation.Path(), ".Members[core][1].") {
+			t.Errorf("expected rule %q at .Members[core][1], got %q at %q", test.rule, validation.Rule(), validation.Path())
+		}
+
+		if fmt.Sprint(validation.Value()) != fmt.Sprint(test.value) {
+			t.Errorf("expected offending value %v, got %v", test.value, validation.Value())
+		}
+	}
+
+	var invalidTag *ErrInvalidTag
+
+	for _, input := range []any{
+		&struct {
+			Name string `pack:"min:1"`
+		}{},
+		&struct {
+			Age int `pack:"max:old"`
+		}{},
+		&struct {
+			Flag bool `pack:"oneof:true"`
+		}{},
+		&struct {
+			Name string `pack:"len:5-1"`
+		}{},
+		&struct {
+			Count int `pack:"utf8"`
+		}{},
+	} {
+		err := Unmarshal([]byte{0, 0}, input)
+		if !errors.As(err, &invalidTag) {
+			t.Errorf("expected %T to return ErrInvalidTag, got %v", input, err)
+		}
+	}
+}
+
 func TestPackerLimit(t *testing.T) {
 
 	t.Parallel()
@@ -353,6 +1314,387 @@ func TestUnpackerLimit(t *testing.T) {
 	}
 }
 
+func TestZeroCopy(t *testing.T) {
+
+	t.Parallel()
+
+	type object struct {
+		String string
+		Bytes  []byte
+		Int    int
+	}
+
+	input, err := Marshal(object{String: "Hello, World!", Bytes: []byte{1, 2, 3}, Int: 1337})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var copied, aliased object
+
+	err = Unmarshal(input, &copied)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Unmarshal(input, &aliased, Options{ZeroCopy: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(copied, aliased) {
+		t.Errorf("expected zero-copy Unmarshal to decode %+v, got %+v", copied, aliased)
+	}
+
+	for i := range input {
+		input[i] = 0xff
+	}
+
+	if copied.String != "Hello, World!" || !bytes.Equal(copied.Bytes, []byte{1, 2, 3}) {
+		t.Errorf("expected Unmarshal to copy out of the input, got %+v", copied)
+	}
+
+	if aliased.String == "Hello, World!" || aliased.Bytes[0] != 0xff {
+		t.Errorf("expected zero-copy Unmarshal to alias the input, got %+v", aliased)
+	}
+
+	err = Unmarshal([]byte{100, 1, 2}, new([]byte), Options{ZeroCopy: true})
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("expected truncated input to return io.ErrUnexpectedEOF, got %v", err)
+	}
+
+	err = Unmarshal([]byte{100}, new([]byte), Options{ZeroCopy: true, SizeLimit: 100})
+	if !reflect.DeepEqual(err, &ErrDataTooLarge{max: 100, size: 101}) {
+		t.Errorf("expected input over SizeLimit to return ErrDataTooLarge, got %v", err)
+	}
+}
+
+// Not parallel, as allocations are counted
+func TestReuse(t *testing.T) {
+	type inner struct {
+		A, B int
+	}
+
+	type object struct {
+		Ints   []int
+		Bytes  []byte
+		Bools  []bool
+		Map    map[int]int
+		Ptr    *inner
+		Inners []inner
+	}
+
+	var (
+		first = object{
+			Ints:   []int{1, 2, 3, 4},
+			Bytes:  []byte("Hello, World!"),
+			Bools:  []bool{true, false, true},
+			Map:    map[int]int{1: 2, 3: 4},
+			Ptr:    &inner{1, 2},
+			Inners: []inner{{1, 2}, {3, 4}},
+		}
+
+		second = object{
+			Ints:   []int{5, 6},
+			Bytes:  []byte("Bye"),
+			Bools:  []bool{false},
+			Map:    map[int]int{5: 6},
+			Ptr:    &inner{3, 4},
+			Inners: []inner{{5, 6}},
+		}
+
+		out object
+	)
+
+	firstData, err := Marshal(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secondData, err := Marshal(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		reader   = bytes.NewReader(firstData)
+		unpacker = NewUnpacker(reader, Options{Reuse: true})
+	)
+
+	err = unpacker.Decode(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		ints   = &out.Ints[0]
+		buf    = &out.Bytes[0]
+		bools  = &out.Bools[0]
+		mp     = reflect.ValueOf(out.Map).UnsafePointer()
+		ptr    = out.Ptr
+		inners = &out.Inners[0]
+	)
+
+	reader.Reset(secondData)
+
+	err = unpacker.Decode(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(out, second) {
+		t.Errorf("expected %+v, got %+v", second, out)
+	}
+
+	if &out.Ints[0] != ints || &out.Bytes[0] != buf || &out.Bools[0] != bools || &out.Inners[0] != inners {
+		t.Errorf("expected slices to be refilled in place")
+	}
+
+	if reflect.ValueOf(out.Map).UnsafePointer() != mp {
+		t.Errorf("expected map to be cleared and refilled")
+	}
+
+	if out.Ptr != ptr {
+		t.Errorf("expected pointer to be decoded into in place")
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		reader.Reset(secondData)
+
+		if err := unpacker.Decode(&out); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	// Receivers of map keys and values
+	if allocs > 2 {
+		t.Errorf("expected at most 2 allocations when reusing, got %v", allocs)
+	}
+
+	// Pointers that are nil in the data are cleared, not kept
+	nilData, err := Marshal(object{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader.Reset(nilData)
+
+	if err = unpacker.Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	if out.Ptr != nil {
+		t.Errorf("expected pointer to be cleared when nil in the data, got %+v", out.Ptr)
+	}
+
+	var (
+		objects = Options{WithObjects: NewObjects(inner{}), Reuse: true}
+
+		obj any = &inner{}
+		old     = obj
+	)
+
+	data, err := Marshal(inner{1, 2}, objects)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Unmarshal(data, &obj, objects)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if obj != old || *obj.(*inner) != (inner{1, 2}) {
+		t.Errorf("expected object of the same type to be decoded into in place, got %+v", obj)
+	}
+}
+
+// Not parallel, as allocations are counted
+func TestAppendMarshal(t *testing.T) {
+	type object struct {
+		String string
+		Int    int
+		Float  float64
+		Bytes  []byte
+		Bools  []bool
+		Array  [3]uint16
+		Ptr    *int
+	}
+
+	var (
+		num = 1337
+
+		input = object{
+			String: "Hello, World!",
+			Int:    1337_1337,
+			Float:  1337.1337,
+			Bytes:  []byte{1, 2, 3},
+			Bools:  []bool{true, false},
+			Array:  [3]uint16{1, 2, 3},
+			Ptr:    &num,
+		}
+
+		options = Options{WithObjects: NewObjects(object{}), SizeLimit: 1000}
+	)
+
+	expected, err := Marshal(input, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err := AppendMarshal([]byte("prefix"), input, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(buf[:6]) != "prefix" || !bytes.Equal(buf[6:], expected) {
+		t.Errorf("expected AppendMarshal to append %x to the prefix, got %x", expected, buf)
+	}
+
+	buf = make([]byte, 0, 256)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, err := AppendMarshal(buf[:0], &input, options); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	if allocs != 0 {
+		t.Errorf("expected AppendMarshal into a pre-sized buffer not to allocate, got %v allocations", allocs)
+	}
+
+	out, err := AppendMarshal(buf, make(chan int))
+	if err == nil || len(out) != 0 {
+		t.Errorf("expected AppendMarshal of invalid type to fail and return dst unchanged, got %x, %v", out, err)
+	}
+}
+
+func TestPackerReset(t *testing.T) {
+
+	t.Parallel()
+
+	var (
+		first, second bytes.Buffer
+
+		packer = NewPacker(&first, Options{WithObjects: NewObjects("")})
+	)
+
+	err := packer.Encode("Hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packer.Reset(&second)
+
+	if packer.BytesWritten() != 0 {
+		t.Errorf("expected Reset to reset bytes written, got %d", packer.BytesWritten())
+	}
+
+	err = packer.Encode("Hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(first.Bytes(), second.Bytes()) || packer.BytesWritten() != uint64(second.Len()) {
+		t.Errorf("expected Packer to keep its options after Reset, got %x and %x", first.Bytes(), second.Bytes())
+	}
+}
+
+func TestSize(t *testing.T) {
+
+	t.Parallel()
+
+	type inner struct {
+		Value any
+	}
+
+	type wrapper struct {
+		Object any `pack:"objects:obj"`
+	}
+
+	type object struct {
+		String  string `pack:"max:20"`
+		Int     int
+		Uints   []uint64
+		Bools   []bool
+		Float   float32
+		Complex complex128
+		Any     any
+		Anys    []any
+		Map     map[string]any
+		Nil     map[int]int
+		Ptr     *inner
+		Array   [2]int16
+		Ignored string `pack:"ignore"`
+	}
+
+	var (
+		input = object{
+			String:  "Hello, World!",
+			Int:     -1337_1337,
+			Uints:   []uint64{0, 127, 128, 1 << 40, 1<<64 - 1},
+			Bools:   []bool{true, false, true, true, false, false, false, false, true},
+			Float:   1337.1337,
+			Complex: complex(1, 2),
+			Any:     []string{"a", "b"},
+			Anys:    []any{nil, 1, "two", 3.0, map[int]bool{4: true}},
+			Map:     map[string]any{"a": int8(-1), "b": [2]uint{1, 2}},
+			Ptr:     &inner{Value: &[]int{1}},
+			Array:   [2]int16{-300, 300},
+			Ignored: "not encoded",
+		}
+
+		inputs = []struct {
+			data    any
+			options Options
+		}{
+			{input, Options{}},
+			{&input, Options{}},
+			{input, Options{WithObjects: NewObjects(object{})}},
+			{wrapper{Object: input}, Options{
+				WithSubObjects: map[string]Objects{"obj": NewObjects(object{})},
+			}},
+			{"", Options{}},
+			{uint(1 << 63), Options{}},
+		}
+	)
+
+	for _, test := range inputs {
+		encoded, err := Marshal(test.data, test.options)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		size, err := Size(test.data, test.options)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if size != len(encoded) {
+			t.Errorf("expected Size(%T) to equal %d, got %d", test.data, len(encoded), size)
+		}
+	}
+
+	for _, test := range []struct {
+		data    any
+		options Options
+	}{
+		{input, Options{SizeLimit: 10}},
+		{input, Options{SizeLimit: 50}},
+		{object{String: strings.Repeat("a", 21)}, Options{}},
+		{make(chan int), Options{}},
+		{nil, Options{}},
+		{nil, Options{WithObjects: NewObjects()}},
+	} {
+		_, expected := Marshal(test.data, test.options)
+
+		_, err := Size(test.data, test.options)
+
+		if expected == nil || !reflect.DeepEqual(err, expected) {
+			t.Errorf("expected Size(%T) to return %v, got %v", test.data, expected, err)
+		}
+	}
+}
+
 func BenchmarkPacker(b *testing.B) {
 	type object struct {
 		String string
@@ -428,3 +1770,31 @@ func BenchmarkUnpacker(b *testing.B) {
 		buffer.Seek(0, io.SeekStart)
 	}
 }
+
+func BenchmarkAppendMarshal(b *testing.B) {
+	type object struct {
+		String string
+		Int    int
+		Float  float64
+		Bytes  []byte
+	}
+
+	var (
+		input = object{
+			String: "Hello, World!",
+			Int:    1337_1337,
+			Float:  1337.1337,
+			Bytes:  []byte("Hello, World!"),
+		}
+
+		buf = make([]byte, 0, 256)
+	)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := AppendMarshal(buf[:0], &input); err != nil {
+			b.Error(err)
+		}
+	}
+}
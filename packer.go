@@ -1,10 +1,12 @@
 package pack
 
 import (
-	"encoding/binary"
+	"fmt"
 	"io"
 	"math"
 	"reflect"
+	"strconv"
+	"sync"
 	"unsafe"
 )
 
@@ -29,11 +31,23 @@ type Packer interface {
 
 	// Set size limit
 	SetSizeLimit(sizeLimit uint64)
+
+	// Encode all data from reader as a stream of chunks, which is decoded
+	// with Unpacker.DecodeStream, max limits the total size of the data
+	// (0 means no limit)
+	EncodeStream(reader io.Reader, max uint64) error
+
+	// Make the Packer write to writer from now on, with bytes written reset
+	// to 0 and its options kept, so it may be reused
+	Reset(writer io.Writer)
 }
 
 type packer struct {
 	realWriter io.Writer
 
+	// Files collected while encoding, only set for Sockets that can pass them
+	files *fileTable
+
 	writer  io.Writer
 	written uint64
 	buffer  dataBuffer
@@ -42,10 +56,57 @@ type packer struct {
 	subobj    map[string]Objects
 	sizelimit uint64
 	stopat    uint64
+	zigzag    bool
+	intern    bool
+	preserve  bool
+	cycles    CyclePolicy
+
+	// Strings encoded so far by the current top-level object and their IDs,
+	// see Options.Intern
+	interned map[string]uint64
+
+	// Pointers, maps and slices encoded so far by the current top-level
+	// object and their IDs, see Options.PreserveReferences
+	refs    map[refKey]uint64
+	nextRef uint64
+
+	// Enforces sizelimit, kept here so it's not allocated for every Encode
+	limited limitedWriter
+
+	// Destination of AppendMarshal
+	appender appendWriter
+
+	// Pointers currently being encoded, to detect cycles
+	seen seen
+
+	// Only count the bytes that would be written, used by Size
+	sizing bool
+}
+
+// Packers used by AppendMarshal
+var packerPool = sync.Pool{
+	New: func() any {
+		return &packer{subobj: map[string]Objects{}}
+	},
 }
 
 func NewPacker(writer io.Writer, options ...Options) Packer {
-	p := &packer{realWriter: writer, subobj: map[string]Objects{}}
+	p := &packer{subobj: map[string]Objects{}}
+
+	p.setOptions(options)
+	p.Reset(writer)
+
+	return p
+}
+
+func (p *packer) setOptions(options []Options) {
+	p.objects = nil
+	p.sizelimit = 0
+	p.zigzag = false
+	p.intern = false
+	p.preserve = false
+	p.cycles = CycleTruncate
+	clear(p.subobj)
 
 	for _, opt := range options {
 		if opt.WithObjects != nil {
@@ -57,30 +118,60 @@ func NewPacker(writer io.Writer, options ...Options) Packer {
 		for key, opt := range opt.WithSubObjects {
 			p.subobj[key] = opt
 		}
+		if opt.ZigZag {
+			p.zigzag = true
+		}
+		if opt.Intern {
+			p.intern = true
+		}
+		if opt.PreserveReferences || opt.CyclePolicy == CyclePreserve {
+			p.preserve = true
+		}
+		if opt.CyclePolicy != CycleTruncate {
+			p.cycles = opt.CyclePolicy
+		}
 	}
+}
 
-	if p.sizelimit <= 0 {
-		p.writer = p.realWriter
-	}
-
-	return p
+func (p *packer) Reset(writer io.Writer) {
+	p.realWriter = writer
+	p.writer = writer
+	p.written = 0
+	p.stopat = 0
 }
 
-func (p *packer) Encode(data any) error {
+// Start enforcing the size limit for a new top-level object
+func (p *packer) startLimit() {
 	if p.sizelimit > 0 {
 		p.stopat = p.written + p.sizelimit
-		p.writer = &limitedWriter{
+		p.limited = limitedWriter{
 			O: p.sizelimit,
 			N: p.sizelimit,
 			W: p.realWriter,
 		}
+		p.writer = &p.limited
 	}
+}
+
+func (p *packer) Encode(data any) error {
+	p.startLimit()
+	p.seen = p.seen[:0]
+	clear(p.interned)
+	clear(p.refs)
+	p.nextRef = 0
 
 	if p.objects != nil {
-		return p.encodeObject(data, p.objects, packerInfo{})
+		return p.encodeObject(reflect.ValueOf(data), p.objects, packerInfo{})
 	}
 
-	return p.encode(data, packerInfo{})
+	return p.encode(reflect.ValueOf(data), packerInfo{})
+}
+
+// Drop the strings and references kept from the last top-level object, so
+// a pooled packer does not keep user data alive
+func (p *packer) release() {
+	clear(p.interned)
+	clear(p.refs)
 }
 
 func (p *packer) BytesWritten() uint64 {
@@ -103,29 +194,98 @@ func (p *packer) SetSizeLimit(sizeLimit uint64) {
 	p.sizelimit = sizeLimit
 }
 
-func (p *packer) encodeObject(data any, objects Objects, info packerInfo) error {
-	for reflect.TypeOf(data).Kind() == reflect.Pointer {
-		val := reflect.ValueOf(data)
+// Account for n bytes in sizing mode, failing as limitedWriter would
+func (p *packer) skip(n int) error {
+	if p.stopat > 0 && p.written+uint64(n) > p.stopat {
+		return &ErrDataTooLarge{max: p.sizelimit, size: p.written + uint64(n) - (p.stopat - p.sizelimit)}
+	}
+
+	p.written += uint64(n)
+
+	return nil
+}
+
+// Write a single byte
+func (p *packer) writeByte(b byte) error {
+	if p.sizing {
+		return p.skip(1)
+	}
+
+	p.buffer[0] = b
+	n, err := p.writer.Write(p.buffer[:1])
+	p.written += uint64(n)
+	return err
+}
+
+func (p *packer) writeVarUint(i uint64) error {
+	if p.sizing {
+		return p.skip(SizeVarUint(i))
+	}
+
+	n, err := WriteVarUint(p.writer, i, p.buffer[:])
+	p.written += uint64(n)
+	return err
+}
+
+func (p *packer) writeVarInt(i int64) error {
+	if p.sizing {
+		return p.skip(SizeVarInt(i))
+	}
+
+	n, err := WriteVarInt(p.writer, i, p.buffer[:])
+	p.written += uint64(n)
+	return err
+}
+
+func (p *packer) write(b []byte) error {
+	if p.sizing {
+		return p.skip(len(b))
+	}
+
+	n, err := p.writer.Write(b)
+	p.written += uint64(n)
+	return err
+}
+
+func (p *packer) encodeObject(val reflect.Value, objects Objects, info packerInfo) error {
+	if !val.IsValid() {
+		return ErrNilObject
+	}
+
+	if val.Kind() == reflect.Interface {
 		if val.IsNil() {
 			return ErrNilObject
 		}
-		data = val.Elem().Interface()
+		val = val.Elem()
 	}
 
-	oid, exists := objects.GetID(data)
+	var ptr reflect.Value
+
+	for val.Kind() == reflect.Pointer {
+		if val.IsNil() {
+			return ErrNilObject
+		}
+		ptr = val
+		val = val.Elem()
+	}
+
+	oid, exists := objectID(objects, val)
 	if !exists {
-		return &ErrNotDefined{typ: reflect.TypeOf(data)}
+		return &ErrNotDefined{typ: val.Type()}
 	}
 
-	n, err := WriteVarUint(p.writer, uint64(oid), p.buffer[:])
-	p.written += uint64(n)
+	err := p.writeVarUint(uint64(oid))
 	if err != nil {
 		return err
 	}
 
+	if p.preserve {
+		p.registerObject(ptr)
+	}
+
 	info.forceAsObject = true
 
-	return p.encode(data, info)
+	return p.encode(val, info)
 }
 
 func (p *packer) encodeBytes(data []byte, inf packerInfo) error {
@@ -139,44 +299,42 @@ func (p *packer) encodeBytes(data []byte, inf packerInfo) error {
 		return &ErrDataTooLarge{max: p.sizelimit, size: p.written + ln}
 	}
 
-	n, err := WriteVarUint(p.writer, ln, p.buffer[:])
-	p.written += uint64(n)
+	err := p.writeVarUint(ln)
 	if err != nil {
 		return err
 	}
 
-	n, err = p.writer.Write(data)
-	p.written += uint64(n)
-
-	return err
+	return p.write(data)
 }
 
-func (p *packer) encodeBoolSlice(data []bool, inf packerInfo) error {
-	var ln = uint64((len(data) + 7) / 8)
+func (p *packer) encodeBoolSlice(val reflect.Value, inf packerInfo) error {
+	var (
+		count = val.Len()
+		ln    = uint64((count + 7) / 8)
+	)
 
 	if inf.maxSize > 0 && ln > inf.maxSize {
-		return &ErrDataTooLarge{typ: reflect.TypeOf(data), max: inf.maxSize, size: uint64(len(data))}
+		return &ErrDataTooLarge{typ: val.Type(), max: inf.maxSize, size: uint64(count)}
 	}
 
 	if p.stopat > 0 && p.written+ln > p.stopat {
 		return &ErrDataTooLarge{max: p.sizelimit, size: p.written + ln}
 	}
 
-	n, err := WriteVarUint(p.writer, uint64(len(data)), p.buffer[:])
-	p.written += uint64(n)
+	err := p.writeVarUint(uint64(count))
 	if err != nil {
 		return err
 	}
 
-	for j := 0; j < len(data); j += 8 {
-		p.buffer[0] = 0
-		for i := 0; i < 8 && j+i < len(data); i++ {
-			if data[j+i] {
-				p.buffer[0] |= byte(1 << i)
+	for j := 0; j < count; j += 8 {
+		var b byte
+		for i := 0; i < 8 && j+i < count; i++ {
+			if val.Index(j + i).Bool() {
+				b |= byte(1 << i)
 			}
 		}
-		n, err = p.writer.Write(p.buffer[:1])
-		p.written += uint64(n)
+
+		err = p.writeByte(b)
 		if err != nil {
 			return err
 		}
@@ -199,9 +357,7 @@ func (p *packer) encodeType(typ reflect.Type) error {
 		return &ErrCantUseInInterfaceMode{kind: kind, typ: typ}
 	}
 
-	p.buffer[0] = byte(kind)
-	n, err := p.writer.Write(p.buffer[:1])
-	p.written += uint64(n)
+	err := p.writeByte(byte(kind))
 	if err != nil {
 		return err
 	}
@@ -214,8 +370,7 @@ func (p *packer) encodeType(typ reflect.Type) error {
 		}
 
 	case reflect.Array:
-		n, err := WriteVarUint(p.writer, uint64(typ.Len()), p.buffer[:])
-		p.written += uint64(n)
+		err = p.writeVarUint(uint64(typ.Len()))
 		if err != nil {
 			return err
 		}
@@ -246,19 +401,29 @@ func (p *packer) encodeType(typ reflect.Type) error {
 	return nil
 }
 
-func (p *packer) encode(data any, info packerInfo) error {
+func (p *packer) encode(val reflect.Value, info packerInfo) error {
 	if info.ignore {
 		return nil
 	}
 
+	// Values of interface fields and elements are encoded as what they hold
+	if val.Kind() == reflect.Interface {
+		val = val.Elem()
+	}
+
+	if info.file || (val.IsValid() && val.Type() == typeFile) {
+		return p.encodeFile(val)
+	}
+
 	var (
-		n   int
 		err error
-
-		typ = reflect.TypeOf(data)
-		val = reflect.ValueOf(data)
+		typ reflect.Type
 	)
 
+	if val.IsValid() {
+		typ = val.Type()
+	}
+
 	if info.markType {
 		err = p.encodeType(typ)
 		if err != nil {
@@ -274,26 +439,36 @@ func (p *packer) encode(data any, info packerInfo) error {
 		return ErrNil
 	}
 
+	if typ.Kind() == reflect.Pointer {
+		// Pointers pushed below are only in the way while encoding this value
+		defer p.seen.truncate(len(p.seen))
+	}
+
 	for typ.Kind() == reflect.Pointer {
+		if p.preserve {
+			done, err := p.encodeRef(val)
+			if done || err != nil {
+				return err
+			}
+
+			typ = typ.Elem()
+			val = val.Elem()
+			continue
+		}
+
 		if val.IsNil() {
-			p.buffer[0] = 0
-			n, err = p.writer.Write(p.buffer[:1])
-			p.written += uint64(n)
-			return err
+			return p.writeByte(0)
 		}
 
-		var ptr = val.Pointer()
-		if info.seen.push(ptr) != nil {
-			p.buffer[0] = 0
-			n, err = p.writer.Write(p.buffer[:1])
-			p.written += uint64(n)
-			return err
+		if p.seen.push(refKey{ptr: val.Pointer(), typ: typ}) != nil {
+			if p.cycles == CycleError {
+				return &ErrCycleAt{}
+			}
+
+			return p.writeByte(0)
 		}
-		defer info.seen.pop()
 
-		p.buffer[0] = 1
-		n, err = p.writer.Write(p.buffer[:1])
-		p.written += uint64(n)
+		err = p.writeByte(1)
 		if err != nil {
 			return err
 		}
@@ -305,91 +480,85 @@ func (p *packer) encode(data any, info packerInfo) error {
 	switch typ.Kind() {
 	case reflect.Bool:
 		if val.Bool() {
-			p.buffer[0] = 1
-		} else {
-			p.buffer[0] = 0
+			return p.writeByte(1)
 		}
-		n, err = p.writer.Write(p.buffer[:1])
-		p.written += uint64(n)
-		return err
+		return p.writeByte(0)
 
 	case reflect.Int8:
-		p.buffer[0] = byte(val.Int())
-		n, err = p.writer.Write(p.buffer[:1])
-		p.written += uint64(n)
-		return err
+		return p.writeByte(byte(val.Int()))
 
 	case reflect.Uint8:
-		p.buffer[0] = byte(val.Uint())
-		n, err = p.writer.Write(p.buffer[:1])
-		p.written += uint64(n)
-		return err
+		return p.writeByte(byte(val.Uint()))
 
 	case reflect.Int, reflect.Int16, reflect.Int32, reflect.Int64:
-		n, err = WriteVarInt(p.writer, val.Int(), p.buffer[:])
-		p.written += uint64(n)
-		return err
+		if info.order != nil {
+			return p.writeFixed(uint64(val.Int()), fixedSize(typ.Kind()), info.order)
+		}
+
+		if info.zigzag || p.zigzag {
+			return p.writeVarUint(zigzag(val.Int()))
+		}
+
+		return p.writeVarInt(val.Int())
 
 	case reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
-		n, err = WriteVarUint(p.writer, val.Uint(), p.buffer[:])
-		p.written += uint64(n)
-		return err
+		if info.order != nil {
+			return p.writeFixed(val.Uint(), fixedSize(typ.Kind()), info.order)
+		}
 
-	case reflect.Float32:
-		binary.BigEndian.PutUint32(p.buffer[0:4], math.Float32bits(val.Interface().(float32)))
+		return p.writeVarUint(val.Uint())
 
-		n, err = p.writer.Write(p.buffer[0:4])
-		p.written += uint64(n)
-		return err
+	case reflect.Float32:
+		return p.writeFixed(uint64(math.Float32bits(float32(val.Float()))), 4, floatOrder(info))
 
 	case reflect.Float64:
-		binary.BigEndian.PutUint64(p.buffer[0:8], math.Float64bits(val.Interface().(float64)))
-
-		n, err = p.writer.Write(p.buffer[0:8])
-		p.written += uint64(n)
-		return err
+		return p.writeFixed(math.Float64bits(val.Float()), 8, floatOrder(info))
 
 	case reflect.Complex64:
-		complex := val.Interface().(complex64)
-		binary.BigEndian.PutUint32(p.buffer[0:4], math.Float32bits(real(complex)))
-		binary.BigEndian.PutUint32(p.buffer[4:8], math.Float32bits(imag(complex)))
+		complex := val.Complex()
+		err = p.writeFixed(uint64(math.Float32bits(float32(real(complex)))), 4, floatOrder(info))
+		if err != nil {
+			return err
+		}
 
-		n, err = p.writer.Write(p.buffer[:8])
-		p.written += uint64(n)
-		return err
+		return p.writeFixed(uint64(math.Float32bits(float32(imag(complex)))), 4, floatOrder(info))
 
 	case reflect.Complex128:
-		complex := val.Interface().(complex128)
-		binary.BigEndian.PutUint64(p.buffer[0:8], math.Float64bits(real(complex)))
-		n, err = p.writer.Write(p.buffer[:8])
-		p.written += uint64(n)
+		complex := val.Complex()
+		err = p.writeFixed(math.Float64bits(real(complex)), 8, floatOrder(info))
 		if err != nil {
 			return err
 		}
 
-		binary.BigEndian.PutUint64(p.buffer[0:8], math.Float64bits(imag(complex)))
-		n, err = p.writer.Write(p.buffer[:8])
-		p.written += uint64(n)
-		return err
+		return p.writeFixed(math.Float64bits(imag(complex)), 8, floatOrder(info))
 
 	case reflect.Array:
 		var (
-			isInterface = typ.Elem().Kind() == reflect.Interface
+			isFile      = isFileType(typ.Elem())
+			isInterface = typ.Elem().Kind() == reflect.Interface && !isFile
 			ln          = typ.Len()
+			elemInfo    = info.elem()
 		)
 
+		elemInfo.markType = isInterface
+		elemInfo.file = isFile
+
+		if info.delta != deltaNone && isDeltaKind(typ.Elem().Kind()) {
+			return p.encodeDelta(val, info)
+		}
+
 		if objects, ok := p.subobj[info.objects]; ok {
 			for i := 0; i < ln; i++ {
-				err = p.encodeObject(val.Index(i).Interface(), objects, packerInfo{seen: info.seen})
+				err = p.encodeObject(val.Index(i), objects, packerInfo{})
 				if err != nil {
-					return err
+					return inPath(err, "["+strconv.Itoa(i)+"]")
 				}
 			}
 		} else {
 			for i := 0; i < ln; i++ {
-				err = p.encode(val.Index(i).Interface(), packerInfo{markType: isInterface, seen: info.seen})
+				err = p.encode(val.Index(i), elemInfo)
 				if err != nil {
-					return err
+					return inPath(err, "["+strconv.Itoa(i)+"]")
 				}
 			}
 		}
@@ -397,13 +566,32 @@ func (p *packer) encode(data any, info packerInfo) error {
 		return nil
 
 	case reflect.Map:
+		if p.preserve {
+			done, err := p.encodeRef(val)
+			if done || err != nil {
+				return err
+			}
+		} else if val.Len() > 0 {
+			// Maps may contain themselves through interfaces
+			defer p.seen.truncate(len(p.seen))
+
+			if p.seen.push(refKey{ptr: val.Pointer(), typ: typ}) != nil {
+				if p.cycles == CycleError {
+					return &ErrCycleAt{}
+				}
+
+				return p.writeVarInt(-1)
+			}
+		}
+
 		var (
-			isInterface = typ.Elem().Kind() == reflect.Interface
+			isFile      = isFileType(typ.Elem())
+			isInterface = typ.Elem().Kind() == reflect.Interface && !isFile
 			ln          = val.Len()
 		)
 
 		if info.maxSize > 0 && uint64(ln) > info.maxSize {
-			return &ErrDataTooLarge{typ: reflect.TypeOf(data), max: info.maxSize, size: uint64(ln)}
+			return &ErrDataTooLarge{typ: typ, max: info.maxSize, size: uint64(ln)}
 		}
 
 		if p.stopat > 0 && p.written+uint64(ln) > p.stopat {
@@ -415,8 +603,7 @@ func (p *packer) encode(data any, info packerInfo) error {
 			ln = -1
 		}
 
-		n, err = WriteVarInt(p.writer, int64(ln), p.buffer[:])
-		p.written += uint64(n)
+		err = p.writeVarInt(int64(ln))
 		if err != nil {
 			return err
 		}
@@ -428,39 +615,27 @@ func (p *packer) encode(data any, info packerInfo) error {
 		iter := val.MapRange()
 
 		if objects, ok := p.subobj[info.objects]; ok {
-			for i := 0; i < ln; i++ {
-			}
 			for iter.Next() {
-				var (
-					curKey = iter.Key()
-					curVal = iter.Value()
-				)
-
-				err = p.encode(curKey.Interface(), packerInfo{seen: info.seen})
+				err = p.encode(iter.Key(), packerInfo{intern: info.intern})
 				if err != nil {
-					return err
+					return inPath(err, fmt.Sprintf("[%v]", iter.Key()))
 				}
 
-				err = p.encodeObject(curVal.Interface(), objects, packerInfo{seen: info.seen})
+				err = p.encodeObject(iter.Value(), objects, packerInfo{})
 				if err != nil {
-					return err
+					return inPath(err, fmt.Sprintf("[%v]", iter.Key()))
 				}
 			}
 		} else {
 			for iter.Next() {
-				var (
-					curKey = iter.Key()
-					curVal = iter.Value()
-				)
-
-				err = p.encode(curKey.Interface(), packerInfo{seen: info.seen})
+				err = p.encode(iter.Key(), packerInfo{intern: info.intern})
 				if err != nil {
-					return err
+					return inPath(err, fmt.Sprintf("[%v]", iter.Key()))
 				}
 
-				err = p.encode(curVal.Interface(), packerInfo{markType: isInterface, seen: info.seen})
+				err = p.encode(iter.Value(), packerInfo{markType: isInterface, file: isFile, intern: info.intern})
 				if err != nil {
-					return err
+					return inPath(err, fmt.Sprintf("[%v]", iter.Key()))
 				}
 			}
 		}
@@ -468,20 +643,42 @@ func (p *packer) encode(data any, info packerInfo) error {
 		return nil
 
 	case reflect.Slice:
+		if p.preserve {
+			done, err := p.encodeRef(val)
+			if done || err != nil {
+				return err
+			}
+		} else if val.Len() > 0 {
+			// Slices may contain themselves through interfaces
+			defer p.seen.truncate(len(p.seen))
+
+			if p.seen.push(refKey{ptr: val.Pointer(), len: val.Len(), typ: typ}) != nil {
+				if p.cycles == CycleError {
+					return &ErrCycleAt{}
+				}
+
+				return p.writeVarUint(0)
+			}
+		}
 
 		switch typ.Elem().Kind() {
 		case reflect.Uint8:
 			return p.encodeBytes(val.Bytes(), info)
 
 		case reflect.Bool:
-			return p.encodeBoolSlice(val.Interface().([]bool), info)
+			return p.encodeBoolSlice(val, info)
 		}
 
 		var (
-			isInterface = typ.Elem().Kind() == reflect.Interface
+			isFile      = isFileType(typ.Elem())
+			isInterface = typ.Elem().Kind() == reflect.Interface && !isFile
 			ln          = val.Len()
+			elemInfo    = info.elem()
 		)
 
+		elemInfo.markType = isInterface
+		elemInfo.file = isFile
+
 		if info.maxSize > 0 && uint64(ln) > info.maxSize {
 			return &ErrDataTooLarge{typ: typ, max: info.maxSize, size: uint64(ln)}
 		}
@@ -490,24 +687,27 @@ func (p *packer) encode(data any, info packerInfo) error {
 			return &ErrDataTooLarge{max: p.sizelimit, size: p.written + uint64(ln)}
 		}
 
-		n, err = WriteVarUint(p.writer, uint64(ln), p.buffer[:])
-		p.written += uint64(n)
+		err = p.writeVarUint(uint64(ln))
 		if err != nil {
 			return err
 		}
 
+		if info.delta != deltaNone && isDeltaKind(typ.Elem().Kind()) {
+			return p.encodeDelta(val, info)
+		}
+
 		if objects, ok := p.subobj[info.objects]; ok {
 			for i := 0; i < ln; i++ {
-				err = p.encodeObject(val.Index(i).Interface(), objects, packerInfo{seen: info.seen})
+				err = p.encodeObject(val.Index(i), objects, packerInfo{})
 				if err != nil {
-					return err
+					return inPath(err, "["+strconv.Itoa(i)+"]")
 				}
 			}
 		} else {
 			for i := 0; i < ln; i++ {
-				err := p.encode(val.Index(i).Interface(), packerInfo{markType: isInterface, seen: info.seen})
+				err := p.encode(val.Index(i), elemInfo)
 				if err != nil {
-					return err
+					return inPath(err, "["+strconv.Itoa(i)+"]")
 				}
 			}
 		}
@@ -515,9 +715,13 @@ func (p *packer) encode(data any, info packerInfo) error {
 		return err
 
 	case reflect.String:
+		if info.intern || p.intern {
+			return p.encodeInterned(val.String(), info)
+		}
+
 		var (
-			str     = val.Interface().(string)
-			encoded = *(*[]byte)(unsafe.Pointer(&str))
+			str     = val.String()
+			encoded = unsafe.Slice(unsafe.StringData(str), len(str))
 		)
 
 		return p.encodeBytes(encoded, info)
@@ -535,33 +739,54 @@ func (p *packer) encode(data any, info packerInfo) error {
 			}
 		}
 
-		ln := typ.NumField()
+		var (
+			st     = structFields(typ)
+			fields = st.fields
+		)
 
-		for i := 0; i < ln; i++ {
-			var curFieldTyp = typ.Field(i)
+		if st.err != nil {
+			return st.err
+		}
 
-			if !curFieldTyp.IsExported() {
-				continue
+		if st.optional > 0 {
+			err := p.encodePresence(val, st)
+			if err != nil {
+				return err
 			}
+		}
 
+		for i := 0; i < len(fields); i++ {
 			var (
-				curVal = val.Field(i)
-
-				curInfo = parsePackerInfo(curFieldTyp.Tag.Get("pack"), info)
-
-				isInterface = curFieldTyp.Type.Kind() == reflect.Interface
+				field   = fields[i]
+				curVal  = val.Field(field.index)
+				curInfo = field.info
 			)
 
-			if objects, ok := p.subobj[curInfo.objects]; ok && isInterface {
-				err := p.encodeObject(curVal.Interface(), objects, curInfo)
+			if field.bit >= 0 && field.isDefault(curVal) {
+				continue
+			}
+
+			if field.bitRun > 0 {
+				err := p.encodeBits(val, fields[i:i+field.bitRun])
 				if err != nil {
 					return err
 				}
+
+				i += field.bitRun - 1
+				continue
+			}
+
+			if objects, ok := p.subobj[curInfo.objects]; ok && field.isInterface {
+				err := p.encodeObject(curVal, objects, curInfo)
+				if err != nil {
+					return inPath(err, "."+field.name)
+				}
 			} else {
-				curInfo.markType = isInterface
-				err := p.encode(curVal.Interface(), curInfo)
+				curInfo.markType = field.isInterface
+				curInfo.file = field.isFile
+				err := p.encode(curVal, curInfo)
 				if err != nil {
-					return err
+					return inPath(err, "."+field.name)
 				}
 			}
 		}
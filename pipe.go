@@ -0,0 +1,319 @@
+package pack
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Amount of objects that may be pending in each direction of a Pipe
+const pipeBuffer = 16
+
+type pipe struct {
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+type pipeSocket struct {
+	pipe *pipe
+
+	sendCh chan<- []byte
+	recvCh <-chan []byte
+
+	writeBuffer *bytes.Buffer
+	readBuffer  *bytes.Reader
+
+	unpacker Unpacker
+	packer   Packer
+
+	wlock sync.Mutex
+	rlock sync.Mutex
+
+	receiver       *receiver
+	incomingBuffer int
+
+	written uint64
+
+	// Limit of objects written with WriteEncoded, as the packer enforces it
+	// on everything else
+	sizeLimit uint64
+
+	// Nil unless Options.WithStats is set
+	stats   StatsCollector
+	objects Objects
+}
+
+// Create a pair of connected in-process Sockets built on channels, objects
+// written to one end can be read from the other, useful for tests
+//
+// Objects are still packed and unpacked, so both ends behave exactly like a
+// Socket over a network connection would. Writes block once 16 objects are
+// pending to be read, and closing either end closes the whole pipe, objects
+// already written may still be read after that
+func NewPipe(options Options) (Socket, Socket) {
+	var (
+		p = &pipe{closed: make(chan struct{})}
+
+		ab = make(chan []byte, pipeBuffer)
+		ba = make(chan []byte, pipeBuffer)
+	)
+
+	return newPipeSocket(p, ab, ba, options), newPipeSocket(p, ba, ab, options)
+}
+
+func newPipeSocket(p *pipe, send chan<- []byte, recv <-chan []byte, options Options) *pipeSocket {
+	if options.WithObjects == nil {
+		panic("WithObjects may not be nil in Socket")
+	}
+
+	var (
+		writeBuffer = bytes.NewBuffer(nil)
+		readBuffer  = bytes.NewReader(nil)
+	)
+
+	return &pipeSocket{
+		pipe: p,
+
+		sendCh: send,
+		recvCh: recv,
+
+		writeBuffer: writeBuffer,
+		readBuffer:  readBuffer,
+
+		unpacker: NewUnpacker(readBuffer, options),
+		packer:   NewPacker(writeBuffer, options),
+
+		receiver:       newReceiver(),
+		incomingBuffer: options.IncomingBuffer,
+
+		sizeLimit: options.SizeLimit,
+
+		stats:   options.WithStats,
+		objects: options.WithObjects,
+	}
+}
+
+func (s *pipeSocket) read(timeout <-chan time.Time) (any, error) {
+	var msg []byte
+
+	select {
+	case msg = <-s.recvCh:
+	case <-s.pipe.closed:
+		// Deliver objects written before the pipe was closed
+		select {
+		case msg = <-s.recvCh:
+		default:
+			return nil, io.EOF
+		}
+	case <-timeout:
+		return nil, os.ErrDeadlineExceeded
+	}
+
+	s.readBuffer.Reset(msg)
+
+	var (
+		receiver any
+		start    time.Time
+	)
+
+	if s.stats != nil {
+		start = time.Now()
+	}
+
+	if err := s.unpacker.Decode(&receiver); err != nil {
+		return nil, err
+	}
+
+	if s.stats != nil {
+		recordStats(s.stats, s.objects, DirectionRead, receiver, uint64(len(msg)), time.Since(start))
+	}
+
+	return receiver, nil
+}
+
+func (s *pipeSocket) write(data any, timeout <-chan time.Time) error {
+	s.writeBuffer.Reset()
+
+	var (
+		start    time.Time
+		duration time.Duration
+	)
+
+	if s.stats != nil {
+		start = time.Now()
+	}
+
+	if err := s.packer.Encode(data); err != nil {
+		return err
+	}
+
+	if s.stats != nil {
+		duration = time.Since(start)
+	}
+
+	msg := append([]byte(nil), s.writeBuffer.Bytes()...)
+
+	err := s.send(msg, timeout)
+
+	if s.stats != nil && err == nil {
+		recordStats(s.stats, s.objects, DirectionWrite, data, uint64(len(msg)), duration)
+	}
+
+	return err
+}
+
+func (s *pipeSocket) send(msg []byte, timeout <-chan time.Time) error {
+	select {
+	case <-s.pipe.closed:
+		return io.ErrClosedPipe
+	default:
+	}
+
+	select {
+	case s.sendCh <- msg:
+		s.written += uint64(len(msg))
+		return nil
+	case <-s.pipe.closed:
+		return io.ErrClosedPipe
+	case <-timeout:
+		return os.ErrDeadlineExceeded
+	}
+}
+
+func (s *pipeSocket) readBlocking() (any, error) {
+	s.rlock.Lock()
+	defer s.rlock.Unlock()
+
+	return s.read(nil)
+}
+
+func (s *pipeSocket) Read() (any, error) {
+	if s.receiver.started.Load() {
+		return nil, ErrReaderStarted
+	}
+
+	s.rlock.Lock()
+	defer s.rlock.Unlock()
+
+	if s.receiver.started.Load() {
+		return nil, ErrReaderStarted
+	}
+
+	return s.read(nil)
+}
+
+func (s *pipeSocket) Write(data any) error {
+	s.wlock.Lock()
+	defer s.wlock.Unlock()
+
+	return s.write(data, nil)
+}
+
+func (s *pipeSocket) WriteEncoded(data []byte) error {
+	if err := checkEncodedSize(s.sizeLimit, data); err != nil {
+		return err
+	}
+
+	s.wlock.Lock()
+	defer s.wlock.Unlock()
+
+	err := s.send(append([]byte(nil), data...), nil)
+
+	if s.stats != nil && err == nil {
+		recordEncodedStats(s.stats, data)
+	}
+
+	return err
+}
+
+func (s *pipeSocket) ReadTimeout(timeout time.Duration) (any, error) {
+	if s.receiver.started.Load() {
+		return nil, ErrReaderStarted
+	}
+
+	s.rlock.Lock()
+	defer s.rlock.Unlock()
+
+	if s.receiver.started.Load() {
+		return nil, ErrReaderStarted
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	return s.read(timer.C)
+}
+
+func (s *pipeSocket) WriteTimeout(data any, timeout time.Duration) error {
+	s.wlock.Lock()
+	defer s.wlock.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	return s.write(data, timer.C)
+}
+
+func (s *pipeSocket) Close() error {
+	s.receiver.stop()
+
+	s.pipe.closeOnce.Do(func() {
+		close(s.pipe.closed)
+	})
+
+	return nil
+}
+
+func (s *pipeSocket) BytesRead() uint64 {
+	s.rlock.Lock()
+	defer s.rlock.Unlock()
+
+	return s.unpacker.BytesRead()
+}
+
+func (s *pipeSocket) BytesWritten() uint64 {
+	s.wlock.Lock()
+	defer s.wlock.Unlock()
+
+	return s.written
+}
+
+func (s *pipeSocket) ResetRead() {
+	s.rlock.Lock()
+	defer s.rlock.Unlock()
+
+	s.unpacker.ResetCounter()
+}
+
+func (s *pipeSocket) ResetWritten() {
+	s.wlock.Lock()
+	defer s.wlock.Unlock()
+
+	s.written = 0
+	s.packer.ResetCounter()
+}
+
+func (s *pipeSocket) ZeroBuffer() {
+	s.wlock.Lock()
+	defer s.wlock.Unlock()
+
+	*s.writeBuffer = bytes.Buffer{}
+}
+
+func (s *pipeSocket) Incoming() <-chan any {
+	s.receiver.start(s.incomingBuffer, s.readBlocking)
+
+	return s.receiver.incoming
+}
+
+func (s *pipeSocket) Err() <-chan error {
+	s.receiver.start(s.incomingBuffer, s.readBlocking)
+
+	return s.receiver.errs
+}
+
+func (s *pipeSocket) PeerInfo() PeerInfo {
+	return PeerInfo{}
+}
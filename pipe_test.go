@@ -0,0 +1,73 @@
+package pack
+
+import (
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPipe(t *testing.T) {
+
+	t.Parallel()
+
+	type object struct {
+		String string
+	}
+
+	var (
+		options = Options{
+			WithObjects: NewObjects(object{}),
+		}
+
+		socketA, socketB = NewPipe(options)
+	)
+
+	err := socketA.Write(object{String: "Hello, World!"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj, err := socketB.ReadTimeout(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if o, ok := obj.(*object); !ok || o.String != "Hello, World!" {
+		t.Errorf("expected to receive *object with String \"Hello, World!\", got %+v", obj)
+	}
+
+	if socketA.BytesWritten() != socketB.BytesRead() {
+		t.Errorf("expected bytes written to equal bytes read, written: %d / read: %d",
+			socketA.BytesWritten(), socketB.BytesRead())
+	}
+
+	_, err = socketA.ReadTimeout(time.Millisecond)
+	if err != os.ErrDeadlineExceeded {
+		t.Errorf("expected socket.ReadTimeout() to return os.ErrDeadlineExceeded, got %v", err)
+	}
+
+	err = socketB.Write(object{String: "Bye"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	socketB.Close()
+
+	obj, err = socketA.Read()
+	if err != nil {
+		t.Fatalf("expected objects written before Close to be readable, got %v", err)
+	}
+
+	if o, ok := obj.(*object); !ok || o.String != "Bye" {
+		t.Errorf("expected to receive *object with String \"Bye\", got %+v", obj)
+	}
+
+	if _, err = socketA.Read(); err != io.EOF {
+		t.Errorf("expected socket.Read() to return io.EOF after Close, got %v", err)
+	}
+
+	if err = socketA.Write(object{}); err != io.ErrClosedPipe {
+		t.Errorf("expected socket.Write() to return io.ErrClosedPipe after Close, got %v", err)
+	}
+}
@@ -0,0 +1,431 @@
+// Package plugin runs helper binaries as subprocesses and talks to them using
+// pack Sockets wired to their stdin and stdout.
+//
+// The host starts the plugin with Start, and the plugin calls Connect to get
+// the matching Socket on its side. Both sides exchange a handshake first,
+// which verifies that their Objects registries agree.
+//
+// Since stdout is used to exchange objects, plugins must write their logs to
+// stderr, which is forwarded to the host's stderr by default.
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"os/exec"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/NublyBR/go-pack"
+)
+
+const (
+	magic   = "go-pack-plugin"
+	version = 1
+
+	// Maximum time to wait for the other side's handshake
+	handshakeTimeout = 10 * time.Second
+
+	// Maximum time to wait for the plugin to exit after its stdout was
+	// closed or after the host closed the Socket
+	exitGracePeriod = time.Second
+)
+
+var (
+	ErrInvalidHandshake = errors.New("plugin: invalid handshake, other side is not a go-pack plugin or uses another protocol version")
+	ErrObjectsMismatch  = errors.New("plugin: Objects registries of host and plugin do not match")
+)
+
+type ExitError struct {
+	// Error returned by exec.Cmd.Wait, nil if the plugin exited with status 0
+	Err error
+}
+
+func (e *ExitError) Error() string {
+	if e.Err == nil {
+		return "plugin: exited"
+	}
+
+	return fmt.Sprintf("plugin: exited: %s", e.Err)
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// Get the exit code of the plugin, or -1 if it was terminated by a signal
+func (e *ExitError) ExitCode() int {
+	var exitErr *exec.ExitError
+	if errors.As(e.Err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+
+	return 0
+}
+
+type Host interface {
+	pack.Socket
+
+	// Get the process of the plugin
+	Process() *os.Process
+
+	// Wait for the plugin to exit and get its exit status, as returned
+	// by exec.Cmd.Wait
+	Wait() error
+}
+
+type hello struct {
+	Magic   string
+	Version uint
+	Objects uint64
+}
+
+// Stdin/stdout pair of a process, used as the stream of a Socket
+type stdio struct {
+	in  *os.File
+	out *os.File
+}
+
+func (s *stdio) Read(b []byte) (int, error) {
+	return s.in.Read(b)
+}
+
+func (s *stdio) Write(b []byte) (int, error) {
+	return s.out.Write(b)
+}
+
+func (s *stdio) Close() error {
+	errIn := s.in.Close()
+	errOut := s.out.Close()
+
+	if errIn != nil {
+		return errIn
+	}
+
+	return errOut
+}
+
+func (s *stdio) SetReadDeadline(t time.Time) error {
+	return s.in.SetReadDeadline(t)
+}
+
+func (s *stdio) SetWriteDeadline(t time.Time) error {
+	return s.out.SetWriteDeadline(t)
+}
+
+// Start the plugin and perform the handshake, options.WithObjects must match
+// the Objects used by the plugin
+//
+// Stdin and stdout of the command are used by the Socket and must not be set,
+// if cmd.Stderr is nil, it's set to os.Stderr
+func Start(cmd *exec.Cmd, options pack.Options) (Host, error) {
+	if options.WithObjects == nil {
+		panic("WithObjects may not be nil in Socket")
+	}
+
+	if cmd.Stdin != nil || cmd.Stdout != nil {
+		return nil, errors.New("plugin: Stdin and Stdout of exec.Cmd must not be set")
+	}
+
+	if cmd.Stderr == nil {
+		cmd.Stderr = os.Stderr
+	}
+
+	stdinR, stdinW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stdoutR, stdoutW, err := os.Pipe()
+	if err != nil {
+		stdinR.Close()
+		stdinW.Close()
+		return nil, err
+	}
+
+	// Passing *os.File directly makes the child inherit the descriptors,
+	// so exec.Cmd.Wait never touches our ends of the pipes
+	cmd.Stdin = stdinR
+	cmd.Stdout = stdoutW
+
+	err = cmd.Start()
+
+	stdinR.Close()
+	stdoutW.Close()
+
+	if err != nil {
+		stdinW.Close()
+		stdoutR.Close()
+		return nil, err
+	}
+
+	var (
+		stream = &stdio{in: stdoutR, out: stdinW}
+
+		h = &host{
+			cmd:    cmd,
+			exited: make(chan struct{}),
+		}
+	)
+
+	go func() {
+		h.waitErr = cmd.Wait()
+		close(h.exited)
+	}()
+
+	if err := handshake(stream, options.WithObjects); err != nil {
+		stream.Close()
+		cmd.Process.Kill()
+		<-h.exited
+
+		if errors.Is(err, os.ErrDeadlineExceeded) || err == ErrInvalidHandshake || err == ErrObjectsMismatch {
+			return nil, err
+		}
+
+		// The plugin most likely died before completing the handshake
+		return nil, &ExitError{Err: h.waitErr}
+	}
+
+	h.Socket = pack.NewStreamSocket(stream, options)
+
+	return h, nil
+}
+
+// Get the Socket connected to the host, to be called from within the plugin,
+// options.WithObjects must match the Objects used by the host
+func Connect(options pack.Options) (pack.Socket, error) {
+	if options.WithObjects == nil {
+		panic("WithObjects may not be nil in Socket")
+	}
+
+	stream := &stdio{in: os.Stdin, out: os.Stdout}
+
+	if err := handshake(stream, options.WithObjects); err != nil {
+		return nil, err
+	}
+
+	return pack.NewStreamSocket(stream, options), nil
+}
+
+// Exchange hello messages with the other side and verify them
+func handshake(stream *stdio, objects pack.Objects) error {
+	var (
+		local = hello{
+			Magic:   magic,
+			Version: version,
+			Objects: fingerprint(objects),
+		}
+
+		remote hello
+
+		errCh = make(chan error, 1)
+	)
+
+	// Write in parallel, so neither side blocks the other if pipes are full
+	go func() {
+		errCh <- pack.NewPacker(stream).Encode(local)
+	}()
+
+	stream.SetReadDeadline(time.Now().Add(handshakeTimeout))
+	defer stream.SetReadDeadline(time.Time{})
+
+	// Limit the size, in case the other side is writing something else entirely
+	if err := pack.NewUnpacker(stream, pack.Options{SizeLimit: 1024}).Decode(&remote); err != nil {
+		var tooLarge *pack.ErrDataTooLarge
+		if errors.As(err, &tooLarge) {
+			return ErrInvalidHandshake
+		}
+
+		return err
+	}
+
+	if err := <-errCh; err != nil {
+		return err
+	}
+
+	if remote.Magic != local.Magic || remote.Version != local.Version {
+		return ErrInvalidHandshake
+	}
+
+	if remote.Objects != local.Objects {
+		return ErrObjectsMismatch
+	}
+
+	return nil
+}
+
+// Compute a hash of the registered objects and their layout
+//
+// Only the structure of the types is hashed, not their names or packages, so
+// host and plugin may each declare their own copy of the types
+//
+// IDs are visited from 1 upwards until the first one that is not registered
+func fingerprint(objects pack.Objects) uint64 {
+	hash := fnv.New64a()
+
+	for id := uint(1); ; id++ {
+		typ, ok := objects.GetType(id)
+		if !ok {
+			break
+		}
+
+		fmt.Fprintf(hash, "%d=", id)
+		describe(hash, typ, map[reflect.Type]int{})
+		fmt.Fprint(hash, ";")
+	}
+
+	return hash.Sum64()
+}
+
+// Write a description of the layout of typ, types met again are written as
+// the order they were first met in, so recursive types are described too
+func describe(w io.Writer, typ reflect.Type, visited map[reflect.Type]int) {
+	if n, ok := visited[typ]; ok {
+		fmt.Fprintf(w, "#%d", n)
+		return
+	}
+	visited[typ] = len(visited)
+
+	fmt.Fprint(w, typ.Kind())
+
+	switch typ.Kind() {
+	case reflect.Struct:
+		fmt.Fprint(w, "{")
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+
+			fmt.Fprintf(w, "%s %q:", field.Name, field.Tag.Get("pack"))
+			describe(w, field.Type, visited)
+			fmt.Fprint(w, ",")
+		}
+		fmt.Fprint(w, "}")
+
+	case reflect.Array:
+		fmt.Fprintf(w, "[%d]", typ.Len())
+		describe(w, typ.Elem(), visited)
+
+	case reflect.Pointer, reflect.Slice:
+		fmt.Fprint(w, "[")
+		describe(w, typ.Elem(), visited)
+		fmt.Fprint(w, "]")
+
+	case reflect.Map:
+		fmt.Fprint(w, "[")
+		describe(w, typ.Key(), visited)
+		fmt.Fprint(w, "]")
+		describe(w, typ.Elem(), visited)
+	}
+}
+
+type host struct {
+	pack.Socket
+
+	cmd *exec.Cmd
+
+	exited  chan struct{}
+	waitErr error
+
+	errOnce sync.Once
+	errs    chan error
+}
+
+func (h *host) Process() *os.Process {
+	return h.cmd.Process
+}
+
+func (h *host) Wait() error {
+	<-h.exited
+
+	return h.waitErr
+}
+
+// Replace an error caused by the plugin exiting with an ExitError
+func (h *host) exitError(err error) error {
+	if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, syscall.EPIPE) {
+		return err
+	}
+
+	timer := time.NewTimer(exitGracePeriod)
+	defer timer.Stop()
+
+	select {
+	case <-h.exited:
+		return &ExitError{Err: h.waitErr}
+	case <-timer.C:
+		return err
+	}
+}
+
+func (h *host) Read() (any, error) {
+	data, err := h.Socket.Read()
+
+	return data, h.exitError(err)
+}
+
+func (h *host) ReadTimeout(timeout time.Duration) (any, error) {
+	data, err := h.Socket.ReadTimeout(timeout)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return data, err
+	}
+
+	return data, h.exitError(err)
+}
+
+func (h *host) Write(data any) error {
+	return h.exitError(h.Socket.Write(data))
+}
+
+func (h *host) WriteTimeout(data any, timeout time.Duration) error {
+	err := h.Socket.WriteTimeout(data, timeout)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return err
+	}
+
+	return h.exitError(err)
+}
+
+func (h *host) WriteEncoded(data []byte) error {
+	return h.exitError(h.Socket.WriteEncoded(data))
+}
+
+func (h *host) Err() <-chan error {
+	h.errOnce.Do(func() {
+		h.errs = make(chan error, 1)
+
+		go func() {
+			defer close(h.errs)
+
+			if err, ok := <-h.Socket.Err(); ok {
+				h.errs <- h.exitError(err)
+			}
+		}()
+	})
+
+	return h.errs
+}
+
+// Close the Socket, which closes the plugin's stdin, and wait for it to exit,
+// killing it if it does not exit in time
+func (h *host) Close() error {
+	err := h.Socket.Close()
+
+	timer := time.NewTimer(exitGracePeriod)
+	defer timer.Stop()
+
+	select {
+	case <-h.exited:
+	case <-timer.C:
+		h.cmd.Process.Kill()
+		<-h.exited
+	}
+
+	return err
+}
@@ -0,0 +1,175 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/NublyBR/go-pack"
+)
+
+type request struct {
+	Value int
+}
+
+type response struct {
+	Value int
+}
+
+type exit struct {
+	Code int
+}
+
+var options = pack.Options{
+	WithObjects: pack.NewObjects(request{}, response{}, exit{}),
+}
+
+// When the test binary is started as a plugin, act as one instead of
+// running the tests
+func TestMain(m *testing.M) {
+	switch os.Getenv("GO_PACK_PLUGIN") {
+	case "":
+		os.Exit(m.Run())
+
+	case "mismatch":
+		pluginMain(pack.Options{WithObjects: pack.NewObjects(response{}, request{})})
+
+	default:
+		pluginMain(options)
+	}
+}
+
+func pluginMain(options pack.Options) {
+	socket, err := Connect(options)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	for {
+		obj, err := socket.Read()
+		if err != nil {
+			os.Exit(0)
+		}
+
+		switch obj := obj.(type) {
+		case *request:
+			socket.Write(response{Value: obj.Value * 2})
+		case *exit:
+			os.Exit(obj.Code)
+		}
+	}
+}
+
+func command(mode string) *exec.Cmd {
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), "GO_PACK_PLUGIN="+mode)
+	return cmd
+}
+
+func TestPlugin(t *testing.T) {
+
+	t.Parallel()
+
+	host, err := Start(command("echo"), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer host.Close()
+
+	err = host.WriteTimeout(request{Value: 21}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj, err := host.ReadTimeout(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if o, ok := obj.(*response); !ok || o.Value != 42 {
+		t.Errorf("expected to receive *response with value 42, got %+v", obj)
+	}
+
+	err = host.WriteTimeout(exit{Code: 3}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = host.ReadTimeout(5 * time.Second)
+
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("expected host.ReadTimeout() to return *ExitError after the plugin exited, got %v", err)
+	}
+
+	if exitErr.ExitCode() != 3 {
+		t.Errorf("expected exit code 3, got %d", exitErr.ExitCode())
+	}
+}
+
+func TestPluginObjectsMismatch(t *testing.T) {
+
+	t.Parallel()
+
+	cmd := command("mismatch")
+	cmd.Stderr = nil
+
+	_, err := Start(cmd, options)
+	if err != ErrObjectsMismatch {
+		t.Errorf("expected Start() to return ErrObjectsMismatch, got %v", err)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+
+	t.Parallel()
+
+	type a struct {
+		Value int
+	}
+
+	type b struct {
+		Value string
+	}
+
+	if fingerprint(pack.NewObjects(a{}, b{})) != fingerprint(pack.NewObjects(a{}, b{})) {
+		t.Error("expected fingerprints of equal Objects to match")
+	}
+
+	if fingerprint(pack.NewObjects(a{}, b{})) == fingerprint(pack.NewObjects(b{}, a{})) {
+		t.Error("expected fingerprints of Objects with different IDs to differ")
+	}
+
+	// Declared separately, as a plugin built from another package would
+	type otherA struct {
+		Value int
+	}
+
+	type renamed struct {
+		Count int
+	}
+
+	if fingerprint(pack.NewObjects(a{}, b{})) != fingerprint(pack.NewObjects(otherA{}, b{})) {
+		t.Error("expected fingerprints of structurally identical types to match")
+	}
+
+	if fingerprint(pack.NewObjects(a{})) == fingerprint(pack.NewObjects(renamed{})) {
+		t.Error("expected fingerprints of types with different field names to differ")
+	}
+
+	type node struct {
+		Children []*node
+	}
+
+	type otherNode struct {
+		Children []*otherNode
+	}
+
+	if fingerprint(pack.NewObjects(node{})) != fingerprint(pack.NewObjects(otherNode{})) {
+		t.Error("expected fingerprints of structurally identical recursive types to match")
+	}
+}
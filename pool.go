@@ -0,0 +1,387 @@
+package pack
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+type PoolOptions struct {
+	// Function used to open new Sockets, may not be nil
+	//
+	// A Pool holds connections to a single address, use one Pool per address
+	Dial func(ctx context.Context) (Socket, error)
+
+	// Maximum amount of Sockets open at the same time, idle or in use,
+	// once reached Get waits for a Socket to be returned (default: 8)
+	MaxSize int
+
+	// Maximum amount of idle Sockets kept open (default: MaxSize)
+	MaxIdle int
+
+	// Idle Sockets older than this are closed instead of being handed out,
+	// 0 means they are kept forever
+	MaxIdleTime time.Duration
+
+	// Optional function used to check Sockets that have been idle for longer
+	// than HealthCheckAfter before handing them out, by returning an error
+	// the Socket is closed and another one is used
+	HealthCheck func(Socket) error
+
+	// Minimum idle time before a Socket is health checked, 0 means Sockets
+	// are checked every time
+	HealthCheckAfter time.Duration
+}
+
+type PoolStats struct {
+	// Sockets currently open, idle or in use
+	Open int
+
+	// Sockets currently idle in the pool
+	Idle int
+
+	// Sockets currently handed out
+	InUse int
+
+	// Amount of new Sockets dialed
+	Dials uint64
+
+	// Amount of failed dial attempts
+	DialErrors uint64
+
+	// Amount of times Get had to wait for a Socket to be returned
+	Waits uint64
+
+	// Total time spent waiting in Get
+	WaitDuration time.Duration
+
+	// Amount of Sockets evicted because they returned a read or write error
+	Errors uint64
+
+	// Amount of Sockets evicted because they failed the health check
+	HealthCheckFailures uint64
+
+	// Amount of idle Sockets closed because of MaxIdle or MaxIdleTime
+	IdleClosed uint64
+}
+
+type Pool interface {
+	// Get an idle Socket, or dial a new one, waiting for one to be returned
+	// if the pool is full, until ctx is done
+	Get(ctx context.Context) (Socket, error)
+
+	// Return a Socket got from Get to the pool, Sockets that returned a read
+	// or write error are closed instead
+	//
+	// Calling Close on the Socket instead also frees its slot in the pool
+	Put(socket Socket)
+
+	// Close the pool and all its idle Sockets, Sockets in use are closed
+	// when returned
+	Close() error
+
+	// Get current pool statistics
+	Stats() PoolStats
+}
+
+type idleSocket struct {
+	socket *pooledSocket
+	since  time.Time
+}
+
+type pool struct {
+	options PoolOptions
+
+	// Holds one token per open Socket
+	slots chan struct{}
+
+	mu     sync.Mutex
+	idle   []idleSocket
+	closed bool
+	stats  PoolStats
+}
+
+// Create a Pool of client Sockets
+func NewPool(options PoolOptions) Pool {
+	if options.Dial == nil {
+		panic("Dial may not be nil in Pool")
+	}
+
+	if options.MaxSize <= 0 {
+		options.MaxSize = 8
+	}
+
+	if options.MaxIdle <= 0 || options.MaxIdle > options.MaxSize {
+		options.MaxIdle = options.MaxSize
+	}
+
+	return &pool{
+		options: options,
+		slots:   make(chan struct{}, options.MaxSize),
+	}
+}
+
+func (p *pool) acquire(ctx context.Context) error {
+	select {
+	case p.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	start := time.Now()
+
+	defer func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		p.stats.Waits++
+		p.stats.WaitDuration += time.Since(start)
+	}()
+
+	select {
+	case p.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *pool) release() {
+	<-p.slots
+}
+
+// Pop the most recently used idle Socket, closing expired ones
+func (p *pool) popIdle() (*pooledSocket, time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for len(p.idle) > 0 {
+		last := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+
+		if p.options.MaxIdleTime > 0 && time.Since(last.since) > p.options.MaxIdleTime {
+			p.stats.IdleClosed++
+			last.socket.Socket.Close()
+			p.release()
+			continue
+		}
+
+		return last.socket, last.since
+	}
+
+	return nil, time.Time{}
+}
+
+func (p *pool) Get(ctx context.Context) (Socket, error) {
+	for {
+		if p.isClosed() {
+			return nil, ErrPoolClosed
+		}
+
+		sock, since := p.popIdle()
+		if sock == nil {
+			break
+		}
+
+		if p.options.HealthCheck != nil && time.Since(since) >= p.options.HealthCheckAfter {
+			if err := p.options.HealthCheck(sock.Socket); err != nil {
+				p.mu.Lock()
+				p.stats.HealthCheckFailures++
+				p.mu.Unlock()
+
+				sock.Socket.Close()
+				p.release()
+				continue
+			}
+		}
+
+		sock.checkout()
+
+		return sock, nil
+	}
+
+	if err := p.acquire(ctx); err != nil {
+		return nil, err
+	}
+
+	// A Socket may have been returned while waiting for a slot
+	if sock, _ := p.popIdle(); sock != nil {
+		p.release()
+		sock.checkout()
+		return sock, nil
+	}
+
+	sock, err := p.options.Dial(ctx)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err != nil {
+		p.stats.DialErrors++
+		p.release()
+		return nil, err
+	}
+
+	p.stats.Dials++
+
+	return &pooledSocket{Socket: sock, pool: p, inUse: true}, nil
+}
+
+func (p *pool) Put(socket Socket) {
+	sock, ok := socket.(*pooledSocket)
+	if !ok || sock.pool != p {
+		panic("Socket given to Put was not got from this Pool")
+	}
+
+	p.put(sock, false)
+}
+
+func (p *pool) put(sock *pooledSocket, discard bool) {
+	sock.mu.Lock()
+	defer sock.mu.Unlock()
+
+	if !sock.inUse {
+		return
+	}
+
+	sock.inUse = false
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch {
+	case sock.err != nil:
+		p.stats.Errors++
+
+	case p.closed, discard:
+
+	case len(p.idle) >= p.options.MaxIdle:
+		p.stats.IdleClosed++
+
+	default:
+		p.idle = append(p.idle, idleSocket{socket: sock, since: time.Now()})
+		return
+	}
+
+	sock.Socket.Close()
+	p.release()
+}
+
+func (p *pool) isClosed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.closed
+}
+
+func (p *pool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil
+	}
+
+	p.closed = true
+
+	for _, idle := range p.idle {
+		idle.socket.Socket.Close()
+		p.release()
+	}
+
+	p.idle = nil
+
+	return nil
+}
+
+func (p *pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := p.stats
+	stats.Open = len(p.slots)
+	stats.Idle = len(p.idle)
+	stats.InUse = stats.Open - stats.Idle
+
+	return stats
+}
+
+// Socket handed out by a Pool, remembers whether it returned an error so
+// that it's evicted once returned
+type pooledSocket struct {
+	Socket
+
+	pool *pool
+
+	mu    sync.Mutex
+	err   error
+	inUse bool
+}
+
+func (s *pooledSocket) checkout() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.inUse = true
+}
+
+func (s *pooledSocket) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+// Any read error leaves the stream in an unknown state
+func (s *pooledSocket) readError(err error) error {
+	if err != nil {
+		s.fail(err)
+	}
+
+	return err
+}
+
+// Write errors only matter if they happened while writing to the
+// connection, not while encoding
+func (s *pooledSocket) writeError(err error) error {
+	var netErr net.Error
+
+	if err != nil && (isConnError(err) || errors.As(err, &netErr)) {
+		s.fail(err)
+	}
+
+	return err
+}
+
+func (s *pooledSocket) Read() (any, error) {
+	data, err := s.Socket.Read()
+	return data, s.readError(err)
+}
+
+func (s *pooledSocket) ReadTimeout(timeout time.Duration) (any, error) {
+	data, err := s.Socket.ReadTimeout(timeout)
+	return data, s.readError(err)
+}
+
+func (s *pooledSocket) Write(data any) error {
+	return s.writeError(s.Socket.Write(data))
+}
+
+func (s *pooledSocket) WriteTimeout(data any, timeout time.Duration) error {
+	return s.writeError(s.Socket.WriteTimeout(data, timeout))
+}
+
+func (s *pooledSocket) WriteEncoded(data []byte) error {
+	return s.writeError(s.Socket.WriteEncoded(data))
+}
+
+// Close the Socket and free its slot in the pool
+func (s *pooledSocket) Close() error {
+	s.pool.put(s, true)
+
+	return nil
+}
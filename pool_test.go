@@ -0,0 +1,125 @@
+package pack
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPool(t *testing.T) {
+
+	t.Parallel()
+
+	var (
+		options = Options{
+			WithObjects: NewObjects(),
+		}
+
+		peers []Socket
+
+		pool = NewPool(PoolOptions{
+			Dial: func(ctx context.Context) (Socket, error) {
+				local, remote := NewPipe(options)
+				peers = append(peers, remote)
+				return local, nil
+			},
+			MaxSize: 2,
+		})
+	)
+
+	defer pool.Close()
+
+	a, err := pool.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := pool.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := pool.Get(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected pool.Get() to time out while the pool is full, got %v", err)
+	}
+
+	pool.Put(a)
+
+	c, err := pool.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c != a {
+		t.Error("expected pool.Get() to reuse the idle Socket")
+	}
+
+	// Break the connection of b
+	peers[1].Close()
+
+	if _, err := b.Read(); err == nil {
+		t.Fatal("expected Read() to fail after the peer was closed")
+	}
+
+	pool.Put(b)
+	pool.Put(c)
+
+	stats := pool.Stats()
+
+	expect := PoolStats{Open: 1, Idle: 1, InUse: 0, Dials: 2, Waits: 1, Errors: 1}
+	stats.WaitDuration = 0
+
+	if stats != expect {
+		t.Errorf("expected pool stats to be %+v, got %+v", expect, stats)
+	}
+}
+
+func TestPoolHealthCheck(t *testing.T) {
+
+	t.Parallel()
+
+	var (
+		options = Options{
+			WithObjects: NewObjects(),
+		}
+
+		dials int
+
+		pool = NewPool(PoolOptions{
+			Dial: func(ctx context.Context) (Socket, error) {
+				dials++
+				local, _ := NewPipe(options)
+				return local, nil
+			},
+			HealthCheck: func(Socket) error {
+				return errors.New("unhealthy")
+			},
+		})
+	)
+
+	defer pool.Close()
+
+	a, err := pool.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool.Put(a)
+
+	b, err := pool.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a == b || dials != 2 {
+		t.Error("expected pool.Get() to dial a new Socket after the idle one failed the health check")
+	}
+
+	if stats := pool.Stats(); stats.HealthCheckFailures != 1 || stats.Open != 1 {
+		t.Errorf("expected 1 health check failure and 1 open Socket, got %+v", stats)
+	}
+}
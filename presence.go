@@ -0,0 +1,52 @@
+package pack
+
+import "reflect"
+
+// Write the presence bitmap of a struct with optional fields, one bit per
+// optional field which is set when the field doesn't hold its default, least
+// significant bit first as in encodeBoolSlice
+func (p *packer) encodePresence(val reflect.Value, st *structInfo) error {
+	var cur byte
+
+	for i := range st.fields {
+		var field = &st.fields[i]
+
+		if field.bit < 0 {
+			continue
+		}
+
+		if !field.isDefault(val.Field(field.index)) {
+			cur |= 1 << (field.bit % 8)
+		}
+
+		if field.bit%8 == 7 {
+			err := p.writeByte(cur)
+			if err != nil {
+				return err
+			}
+
+			cur = 0
+		}
+	}
+
+	if st.optional%8 != 0 {
+		return p.writeByte(cur)
+	}
+
+	return nil
+}
+
+// Read the presence bitmap of a struct with optional fields into presence
+func (u *unpacker) readPresence(presence []byte) error {
+	for i := range presence {
+		n, err := u.reader.Read(u.buffer[:1])
+		u.read += uint64(n)
+		if err != nil {
+			return err
+		}
+
+		presence[i] = u.buffer[0]
+	}
+
+	return nil
+}
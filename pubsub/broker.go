@@ -0,0 +1,240 @@
+package pubsub
+
+import (
+	"net"
+	"sync"
+
+	"github.com/NublyBR/go-pack"
+)
+
+// What the Broker does once the queue of a subscriber is full
+type Policy int
+
+const (
+	// Close the connection of the subscriber
+	PolicyDisconnect Policy = iota
+
+	// Drop the oldest message in the queue of the subscriber
+	PolicyDropOldest
+
+	// Wait for room in the queue of the subscriber, which slows down the
+	// publisher until the subscriber catches up
+	PolicyBlock
+)
+
+type BrokerOptions struct {
+	// Amount of messages queued for each subscriber (default: 64)
+	QueueSize int
+
+	// What to do with subscribers whose queue is full
+	SlowPolicy Policy
+}
+
+type Broker struct {
+	options BrokerOptions
+
+	mu      sync.RWMutex
+	clients map[*client]struct{}
+	closed  bool
+}
+
+type client struct {
+	socket pack.Socket
+
+	// Guarded by Broker.mu, amount of subscriptions for each filter
+	subs map[filter]int
+
+	queue chan []byte
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (c *client) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.socket.Close()
+	})
+}
+
+func (c *client) matches(msg *message) bool {
+	for f := range c.subs {
+		if f.matches(msg) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *client) writeLoop() {
+	for {
+		select {
+		case data := <-c.queue:
+			if err := c.socket.WriteEncoded(data); err != nil {
+				c.close()
+				return
+			}
+
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *client) enqueue(data []byte, policy Policy) {
+	switch policy {
+	case PolicyBlock:
+		select {
+		case c.queue <- data:
+		case <-c.done:
+		}
+
+	case PolicyDropOldest:
+		for {
+			select {
+			case c.queue <- data:
+				return
+			default:
+			}
+
+			select {
+			case <-c.queue:
+			default:
+			}
+		}
+
+	default:
+		select {
+		case c.queue <- data:
+		default:
+			c.close()
+		}
+	}
+}
+
+func NewBroker(options BrokerOptions) *Broker {
+	if options.QueueSize <= 0 {
+		options.QueueSize = 64
+	}
+
+	return &Broker{
+		options: options,
+		clients: map[*client]struct{}{},
+	}
+}
+
+// Accept connections from l and handle each of them in its own goroutine,
+// until l is closed
+func (b *Broker) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+
+		go b.Handle(pack.NewSocket(conn, SocketOptions()))
+	}
+}
+
+// Handle a client until its connection is lost, the Socket must be created
+// with SocketOptions and is closed once done
+func (b *Broker) Handle(socket pack.Socket) error {
+	c := &client{
+		socket: socket,
+		subs:   map[filter]int{},
+		queue:  make(chan []byte, b.options.QueueSize),
+		done:   make(chan struct{}),
+	}
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		socket.Close()
+		return ErrBrokerClosed
+	}
+	b.clients[c] = struct{}{}
+	b.mu.Unlock()
+
+	defer func() {
+		b.mu.Lock()
+		delete(b.clients, c)
+		b.mu.Unlock()
+
+		c.close()
+	}()
+
+	go c.writeLoop()
+
+	for {
+		obj, err := socket.Read()
+		if err != nil {
+			select {
+			case <-c.done:
+				// Closed by the broker
+				return nil
+			default:
+				return err
+			}
+		}
+
+		switch msg := obj.(type) {
+		case *subscribe:
+			b.mu.Lock()
+			c.subs[msg.Filter]++
+			b.mu.Unlock()
+
+		case *unsubscribe:
+			b.mu.Lock()
+			if c.subs[msg.Filter] <= 1 {
+				delete(c.subs, msg.Filter)
+			} else {
+				c.subs[msg.Filter]--
+			}
+			b.mu.Unlock()
+
+		case *message:
+			if err := b.publish(msg); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Send msg to every matching subscriber, packing it only once
+func (b *Broker) publish(msg *message) error {
+	data, err := pack.Marshal(msg, SocketOptions())
+	if err != nil {
+		return err
+	}
+
+	var targets []*client
+
+	b.mu.RLock()
+	for c := range b.clients {
+		if c.matches(msg) {
+			targets = append(targets, c)
+		}
+	}
+	b.mu.RUnlock()
+
+	for _, c := range targets {
+		c.enqueue(data, b.options.SlowPolicy)
+	}
+
+	return nil
+}
+
+// Disconnect every client, the broker may not be used anymore
+func (b *Broker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+
+	for c := range b.clients {
+		c.close()
+	}
+
+	return nil
+}
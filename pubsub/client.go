@@ -0,0 +1,314 @@
+package pubsub
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	"github.com/NublyBR/go-pack"
+)
+
+// Capacity of the channel of each Subscription
+const subscriptionBuffer = 64
+
+type Client struct {
+	socket pack.Socket
+
+	// Options used to pack and unpack published objects
+	options pack.Options
+
+	mu     sync.Mutex
+	subs   map[subscriber]struct{}
+	err    error
+	closed bool
+
+	done chan struct{}
+}
+
+type subscriber interface {
+	filter() filter
+	deliver(msg *message)
+	close()
+}
+
+// Create a Client over a Socket connected to a Broker, which must be created
+// with SocketOptions
+//
+// Published objects are packed with given Options, subscribers must use
+// Options with the same Objects
+func NewClient(socket pack.Socket, options pack.Options) *Client {
+	c := &Client{
+		socket:  socket,
+		options: options,
+		subs:    map[subscriber]struct{}{},
+		done:    make(chan struct{}),
+	}
+
+	go c.readLoop()
+
+	return c
+}
+
+func (c *Client) readLoop() {
+	defer close(c.done)
+
+	for {
+		obj, err := c.socket.Read()
+		if err != nil {
+			c.mu.Lock()
+			c.err = err
+			subs := c.subs
+			c.subs = map[subscriber]struct{}{}
+			c.mu.Unlock()
+
+			for sub := range subs {
+				sub.close()
+			}
+
+			return
+		}
+
+		msg, ok := obj.(*message)
+		if !ok {
+			continue
+		}
+
+		c.mu.Lock()
+		var targets []subscriber
+		for sub := range c.subs {
+			if sub.filter().matches(msg) {
+				targets = append(targets, sub)
+			}
+		}
+		c.mu.Unlock()
+
+		for _, sub := range targets {
+			sub.deliver(msg)
+		}
+	}
+}
+
+// Publish data on topic, data must be one of the Objects in the Client's
+// Options if it has any
+func (c *Client) Publish(topic string, data any) error {
+	msg := &message{Topic: topic}
+
+	if c.options.WithObjects != nil && data != nil {
+		// Unregistered types are reported by Marshal
+		msg.Type, _ = c.options.WithObjects.GetID(data)
+	}
+
+	payload, err := pack.Marshal(data, c.options)
+	if err != nil {
+		return err
+	}
+
+	msg.Payload = payload
+
+	return c.socket.Write(msg)
+}
+
+// Get the error that stopped the Client, nil while it's running
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.err
+}
+
+// Close the connection to the Broker along with every Subscription
+func (c *Client) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+
+	err := c.socket.Close()
+
+	<-c.done
+
+	return err
+}
+
+func (c *Client) add(sub subscriber) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed || c.err != nil {
+		return ErrClosed
+	}
+
+	c.subs[sub] = struct{}{}
+
+	return nil
+}
+
+func (c *Client) remove(sub subscriber) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.subs[sub]; !ok {
+		return false
+	}
+
+	delete(c.subs, sub)
+
+	return true
+}
+
+type Subscription[T any] struct {
+	// Receives published objects, closed once the Subscription or its Client
+	// is closed
+	//
+	// Delivering never waits for the receiver, so a slow Subscription does not
+	// hold back the others, once C is full its oldest object is dropped to
+	// make room for the newest
+	C <-chan T
+
+	client *Client
+	topic  filter
+	ch     chan T
+
+	dropped atomic.Uint64
+
+	// Guards closing ch while delivering
+	mu        sync.Mutex
+	err       error
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Subscribe to objects of type T published on topic
+//
+// An empty topic matches every topic, and an interface T matches objects of
+// every type, so Subscribe[any](c, "") receives everything published
+func Subscribe[T any](c *Client, topic string) (*Subscription[T], error) {
+	f := filter{Topic: topic}
+
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+
+	if typ.Kind() != reflect.Interface && c.options.WithObjects != nil {
+		id, ok := c.options.WithObjects.GetID(reflect.New(typ).Interface())
+		if !ok {
+			return nil, ErrNotRegistered
+		}
+
+		f.Type = id
+	}
+
+	ch := make(chan T, subscriptionBuffer)
+
+	sub := &Subscription[T]{
+		C:      ch,
+		client: c,
+		topic:  f,
+		ch:     ch,
+		done:   make(chan struct{}),
+	}
+
+	if err := c.add(sub); err != nil {
+		return nil, err
+	}
+
+	if err := c.socket.Write(&subscribe{Filter: f}); err != nil {
+		c.remove(sub)
+		return nil, err
+	}
+
+	return sub, nil
+}
+
+func (s *Subscription[T]) filter() filter {
+	return s.topic
+}
+
+// Decode msg and send it on the channel, dropping the oldest object if full
+func (s *Subscription[T]) deliver(msg *message) {
+	var val T
+
+	if s.client.options.WithObjects != nil {
+		var obj any
+
+		if err := pack.Unmarshal(msg.Payload, &obj, s.client.options); err != nil {
+			s.fail(err)
+			return
+		}
+
+		switch obj := obj.(type) {
+		case T:
+			val = obj
+		case *T:
+			val = *obj
+		default:
+			return
+		}
+	} else if err := pack.Unmarshal(msg.Payload, &val, s.client.options); err != nil {
+		s.fail(err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		default:
+		}
+
+		select {
+		case s.ch <- val:
+			return
+		default:
+		}
+
+		select {
+		case <-s.ch:
+			s.dropped.Add(1)
+		default:
+		}
+	}
+}
+
+func (s *Subscription[T]) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.err = err
+}
+
+// Get the last error decoding an object published to the Subscription, such
+// objects are skipped
+func (s *Subscription[T]) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.err
+}
+
+// Get the amount of objects dropped because C was full
+func (s *Subscription[T]) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+func (s *Subscription[T]) close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+
+		s.mu.Lock()
+		close(s.ch)
+		s.mu.Unlock()
+	})
+}
+
+// Stop receiving objects and close C
+func (s *Subscription[T]) Close() error {
+	if !s.client.remove(s) {
+		s.close()
+		return nil
+	}
+
+	s.close()
+
+	return s.client.socket.Write(&unsubscribe{Filter: s.topic})
+}
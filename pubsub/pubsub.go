@@ -0,0 +1,63 @@
+// Package pubsub implements a publish/subscribe broker over pack Sockets.
+//
+// Clients subscribe to topics, Object types, or both, and the Broker fans out
+// published objects to every matching subscriber. Published objects are
+// packed once by the publisher and forwarded as-is by the Broker, which
+// never needs to know their types.
+package pubsub
+
+import (
+	"errors"
+
+	"github.com/NublyBR/go-pack"
+)
+
+var (
+	// Returned when using a Client that has been closed
+	ErrClosed = errors.New("pubsub: client is closed")
+
+	// Returned by Broker.Handle once the Broker has been closed
+	ErrBrokerClosed = errors.New("pubsub: broker is closed")
+
+	// Returned by Subscribe when T is not one of the Client's Objects
+	ErrNotRegistered = errors.New("pubsub: type not registered in Objects")
+)
+
+// Objects exchanged between Broker and clients
+var objects = pack.NewObjects(subscribe{}, unsubscribe{}, message{})
+
+// Get the Options that Sockets given to Broker.Handle and NewClient must
+// be created with
+func SocketOptions() pack.Options {
+	return pack.Options{WithObjects: objects}
+}
+
+// Subscription filter, empty topic or type 0 match anything
+type filter struct {
+	Topic string
+	Type  uint
+}
+
+func (f filter) matches(msg *message) bool {
+	return (f.Topic == "" || f.Topic == msg.Topic) && (f.Type == 0 || f.Type == msg.Type)
+}
+
+type subscribe struct {
+	Filter filter
+}
+
+type unsubscribe struct {
+	Filter filter
+}
+
+// Published object, sent from publishers to the Broker and from the
+// Broker to subscribers
+type message struct {
+	Topic string
+
+	// Object ID of the payload in the publisher's Objects
+	Type uint
+
+	// Object packed with the publisher's Options
+	Payload []byte
+}
@@ -0,0 +1,326 @@
+package pubsub
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/NublyBR/go-pack"
+)
+
+type chat struct {
+	Text string
+}
+
+type join struct {
+	Name string
+}
+
+var payloadOptions = pack.Options{
+	WithObjects: pack.NewObjects(chat{}, join{}),
+}
+
+// Connect a new Client to broker
+func connect(t *testing.T, broker *Broker) *Client {
+	t.Helper()
+
+	clientSide, brokerSide := pack.NewPipe(SocketOptions())
+
+	go broker.Handle(brokerSide)
+
+	client := NewClient(clientSide, payloadOptions)
+	t.Cleanup(func() { client.Close() })
+
+	return client
+}
+
+// Wait until the broker has processed every message sent by client so far
+func flush(t *testing.T, client *Client) {
+	t.Helper()
+
+	sub, err := Subscribe[chat](client, "sync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	if err := client.Publish("sync", chat{}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-sub.C:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for sync message")
+	}
+}
+
+func receive[T any](t *testing.T, sub *Subscription[T]) T {
+	t.Helper()
+
+	select {
+	case val, ok := <-sub.C:
+		if !ok {
+			t.Fatal("expected subscription to be open")
+		}
+		return val
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for message")
+	}
+
+	panic("unreachable")
+}
+
+func TestPubSub(t *testing.T) {
+
+	t.Parallel()
+
+	var (
+		broker = NewBroker(BrokerOptions{})
+
+		alice = connect(t, broker)
+		bob   = connect(t, broker)
+	)
+
+	defer broker.Close()
+
+	general, err := Subscribe[chat](bob, "general")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	joins, err := Subscribe[join](bob, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	everything, err := Subscribe[any](bob, "general")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flush(t, bob)
+
+	for _, msg := range []struct {
+		topic string
+		data  any
+	}{
+		{"random", chat{Text: "ignored"}},
+		{"general", join{Name: "alice"}},
+		{"general", chat{Text: "hello"}},
+	} {
+		if err := alice.Publish(msg.topic, msg.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if msg := receive(t, general); msg.Text != "hello" {
+		t.Errorf("expected chat \"hello\" on general, got %+v", msg)
+	}
+
+	if msg := receive(t, joins); msg.Name != "alice" {
+		t.Errorf("expected join of \"alice\", got %+v", msg)
+	}
+
+	if msg, ok := receive(t, everything).(*join); !ok || msg.Name != "alice" {
+		t.Errorf("expected *join of \"alice\" first, got %+v", msg)
+	}
+
+	if msg, ok := receive(t, everything).(*chat); !ok || msg.Text != "hello" {
+		t.Errorf("expected *chat \"hello\" second, got %+v", msg)
+	}
+
+	general.Close()
+
+	if _, ok := <-general.C; ok {
+		t.Errorf("expected channel of closed subscription to be closed")
+	}
+
+	flush(t, bob)
+
+	if err := alice.Publish("general", chat{Text: "bye"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if msg, ok := receive(t, everything).(*chat); !ok || msg.Text != "bye" {
+		t.Errorf("expected *chat \"bye\", got %+v", msg)
+	}
+
+	if _, err := Subscribe[struct{}](bob, ""); err != ErrNotRegistered {
+		t.Errorf("expected ErrNotRegistered for unregistered type, got %v", err)
+	}
+}
+
+// Connect a subscriber that does not read anything until told to
+func connectSlow(t *testing.T, broker *Broker) pack.Socket {
+	t.Helper()
+
+	clientSide, brokerSide := pack.NewPipe(SocketOptions())
+
+	go broker.Handle(brokerSide)
+
+	if err := clientSide.Write(&subscribe{Filter: filter{Topic: "flood"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { clientSide.Close() })
+
+	return clientSide
+}
+
+func TestSlowPolicy(t *testing.T) {
+
+	t.Parallel()
+
+	const amount = 100
+
+	for _, policy := range []Policy{PolicyDisconnect, PolicyDropOldest} {
+		var (
+			broker    = NewBroker(BrokerOptions{QueueSize: 1, SlowPolicy: policy})
+			slow      = connectSlow(t, broker)
+			publisher = connect(t, broker)
+		)
+
+		for i := 0; i < amount; i++ {
+			if err := publisher.Publish("flood", chat{Text: fmt.Sprint(i)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		flush(t, publisher)
+
+		var (
+			received int
+			last     chat
+			err      error
+		)
+
+		for {
+			var obj any
+
+			obj, err = slow.ReadTimeout(100 * time.Millisecond)
+			if err != nil {
+				break
+			}
+
+			var msg any
+			if err := pack.Unmarshal(obj.(*message).Payload, &msg, payloadOptions); err != nil {
+				t.Fatal(err)
+			}
+
+			received++
+			last = *msg.(*chat)
+		}
+
+		if received >= amount {
+			t.Errorf("policy %d: expected slow subscriber to miss messages, got all %d", policy, received)
+		}
+
+		switch policy {
+		case PolicyDisconnect:
+			if err != io.EOF {
+				t.Errorf("policy %d: expected slow subscriber to be disconnected, got %v", policy, err)
+			}
+
+		case PolicyDropOldest:
+			if err != os.ErrDeadlineExceeded {
+				t.Errorf("policy %d: expected slow subscriber to stay connected, got %v", policy, err)
+			}
+
+			if last.Text != fmt.Sprint(amount-1) {
+				t.Errorf("policy %d: expected last message to be the newest one, got %+v", policy, last)
+			}
+		}
+
+		broker.Close()
+	}
+}
+
+func TestSubscriptionSlow(t *testing.T) {
+
+	t.Parallel()
+
+	const amount = subscriptionBuffer * 2
+
+	var (
+		broker = NewBroker(BrokerOptions{SlowPolicy: PolicyBlock})
+		client = connect(t, broker)
+	)
+
+	defer broker.Close()
+
+	slow, err := Subscribe[chat](client, "flood")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := Subscribe[chat](client, "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flush(t, client)
+
+	for i := 0; i < amount; i++ {
+		if err := client.Publish("flood", chat{Text: fmt.Sprint(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Not held back by the full Subscription
+	if err := client.Publish("other", chat{Text: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if msg := receive(t, other); msg.Text != "hello" {
+		t.Errorf("expected chat \"hello\" on other, got %+v", msg)
+	}
+
+	if dropped := slow.Dropped(); dropped != amount-subscriptionBuffer {
+		t.Errorf("expected %d objects to be dropped, got %d", amount-subscriptionBuffer, dropped)
+	}
+
+	if msg := receive(t, slow); msg.Text != fmt.Sprint(amount-subscriptionBuffer) {
+		t.Errorf("expected oldest kept object to be %d, got %+v", amount-subscriptionBuffer, msg)
+	}
+}
+
+func TestSubscriptionErr(t *testing.T) {
+
+	t.Parallel()
+
+	var (
+		broker = NewBroker(BrokerOptions{})
+		client = connect(t, broker)
+	)
+
+	defer broker.Close()
+
+	sub, err := Subscribe[chat](client, "bad")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flush(t, client)
+
+	id, _ := payloadOptions.WithObjects.GetID(chat{})
+
+	err = client.socket.Write(&message{Topic: "bad", Type: id, Payload: []byte{0xff}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Publish("bad", chat{Text: "good"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if msg := receive(t, sub); msg.Text != "good" {
+		t.Errorf("expected undecodable object to be skipped, got %+v", msg)
+	}
+
+	if sub.Err() == nil {
+		t.Errorf("expected decoding error to be reported")
+	}
+}
@@ -0,0 +1,73 @@
+package pack
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Default capacity of the channel returned by Socket.Incoming
+const defaultIncomingBuffer = 16
+
+// Internal reader that delivers objects read from a socket over channels
+type receiver struct {
+	once    sync.Once
+	started atomic.Bool
+
+	incoming chan any
+	errs     chan error
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newReceiver() *receiver {
+	return &receiver{done: make(chan struct{})}
+}
+
+// Start reading objects in the background using given function,
+// does nothing if already started
+func (r *receiver) start(size int, read func() (any, error)) {
+	r.once.Do(func() {
+		if size <= 0 {
+			size = defaultIncomingBuffer
+		}
+
+		r.incoming = make(chan any, size)
+		r.errs = make(chan error, 1)
+		r.started.Store(true)
+
+		go r.loop(read)
+	})
+}
+
+func (r *receiver) loop(read func() (any, error)) {
+	defer close(r.errs)
+	defer close(r.incoming)
+
+	for {
+		data, err := read()
+		if err != nil {
+			select {
+			case <-r.done:
+				// Error caused by closing the socket, not reported
+			default:
+				r.errs <- err
+			}
+			return
+		}
+
+		select {
+		case r.incoming <- data:
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// Signal the reader to stop, must be followed by closing the underlying
+// connection so that any pending read returns
+func (r *receiver) stop() {
+	r.closeOnce.Do(func() {
+		close(r.done)
+	})
+}
@@ -0,0 +1,603 @@
+package pack
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// State of the connection of a ReconnectingSocket
+type ConnState int
+
+const (
+	// A connection is being established
+	StateConnecting ConnState = iota
+
+	// A connection is established and ready to be used
+	StateConnected
+
+	// The last connection was lost or a connection attempt failed
+	StateDisconnected
+
+	// The socket was closed and will not reconnect anymore
+	StateClosed
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	case StateDisconnected:
+		return "disconnected"
+	case StateClosed:
+		return "closed"
+	}
+
+	return "unknown"
+}
+
+type ReconnectOptions struct {
+	// Function used to establish a new connection, may not be nil
+	Dial func() (net.Conn, error)
+
+	// Optional function called on every new connection before it is used,
+	// by returning an error the connection is dropped and a new attempt is made
+	Handshake func(Socket) error
+
+	// Delay before the first reconnection attempt, doubles on every failed
+	// attempt up to MaxBackoff (default: 100ms)
+	MinBackoff time.Duration
+
+	// Maximum delay between reconnection attempts (default: 30s)
+	MaxBackoff time.Duration
+
+	// Fraction of the delay that is randomized, in the range [0, 1], values
+	// outside of it are clamped (e.g. 0.2 means the delay varies by up to ±20%)
+	Jitter float64
+
+	// Maximum consecutive failed attempts before an operation gives up and
+	// returns the last dial error, 0 means retry forever
+	MaxAttempts int
+
+	// Keep every written object until Ack is called, and write them again
+	// in order after a reconnection
+	Replay bool
+
+	// Maximum amount of unacknowledged objects kept for replay, once reached
+	// the oldest ones are discarded, 0 means unlimited
+	ReplayLimit int
+
+	// Optional function called whenever the connection state changes,
+	// err holds the reason for the change, if any
+	//
+	// Called synchronously, so it must not block or use the socket
+	OnStateChange func(state ConnState, err error)
+}
+
+type ReconnectingSocket interface {
+	Socket
+
+	// Acknowledge every object written so far, removing them from the replay queue
+	Ack()
+
+	// Get current connection state
+	State() ConnState
+}
+
+type reconnectingSocket struct {
+	options   Options
+	reconnect ReconnectOptions
+
+	// Serializes connection attempts, held while dialing and backing off
+	dialMu sync.Mutex
+
+	// Guards the fields below, never held while dialing or backing off
+	mu sync.Mutex
+
+	current Socket
+	state   ConnState
+	closed  bool
+
+	// Bytes read/written by previous connections
+	read, written uint64
+
+	closeCh   chan struct{}
+	closeOnce sync.Once
+
+	replayMu sync.Mutex
+	pending  []any
+
+	// Serializes reads, so that starting the receiver is checked under it
+	rlock    sync.Mutex
+	receiver *receiver
+}
+
+// Create a client Socket that dials lazily and transparently reconnects with
+// exponential backoff whenever the underlying connection is lost
+func NewReconnectingSocket(options Options, reconnect ReconnectOptions) ReconnectingSocket {
+	if options.WithObjects == nil {
+		panic("WithObjects may not be nil in Socket")
+	}
+
+	if reconnect.Dial == nil {
+		panic("Dial may not be nil in ReconnectingSocket")
+	}
+
+	if reconnect.MinBackoff <= 0 {
+		reconnect.MinBackoff = 100 * time.Millisecond
+	}
+
+	if reconnect.MaxBackoff <= 0 {
+		reconnect.MaxBackoff = 30 * time.Second
+	}
+
+	if reconnect.MaxBackoff < reconnect.MinBackoff {
+		reconnect.MaxBackoff = reconnect.MinBackoff
+	}
+
+	reconnect.Jitter = min(max(reconnect.Jitter, 0), 1)
+
+	return &reconnectingSocket{
+		options:   options,
+		reconnect: reconnect,
+		state:     StateDisconnected,
+		closeCh:   make(chan struct{}),
+		receiver:  newReceiver(),
+	}
+}
+
+func (r *reconnectingSocket) setState(state ConnState, err error) {
+	if r.state == state && err == nil {
+		return
+	}
+
+	r.state = state
+
+	if r.reconnect.OnStateChange != nil {
+		r.reconnect.OnStateChange(state, err)
+	}
+}
+
+func (r *reconnectingSocket) backoff(attempt int) time.Duration {
+	delay := r.reconnect.MinBackoff
+
+	for i := 1; i < attempt && delay < r.reconnect.MaxBackoff; i++ {
+		delay *= 2
+	}
+
+	if delay > r.reconnect.MaxBackoff {
+		delay = r.reconnect.MaxBackoff
+	}
+
+	if r.reconnect.Jitter > 0 {
+		delay = time.Duration(float64(delay) * (1 + r.reconnect.Jitter*(2*rand.Float64()-1)))
+	}
+
+	return delay
+}
+
+// Get the current socket, or nil if there is none, setting state to
+// StateConnecting in that case
+func (r *reconnectingSocket) currentOrConnecting() (Socket, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return nil, net.ErrClosed
+	}
+
+	if r.current == nil {
+		r.setState(StateConnecting, nil)
+	}
+
+	return r.current, nil
+}
+
+// Get the current socket, connecting if necessary
+func (r *reconnectingSocket) conn(deadline time.Time) (Socket, error) {
+	r.mu.Lock()
+	current, closed := r.current, r.closed
+	r.mu.Unlock()
+
+	if current != nil && !closed {
+		return current, nil
+	}
+
+	// Dial and back off without holding mu, so a hanging Dial doesn't block
+	// Close, State or the counters
+	r.dialMu.Lock()
+	defer r.dialMu.Unlock()
+
+	for attempt := 1; ; attempt++ {
+		current, err := r.currentOrConnecting()
+		if current != nil || err != nil {
+			return current, err
+		}
+
+		sock, err := r.dial()
+
+		r.mu.Lock()
+
+		if r.closed {
+			r.mu.Unlock()
+
+			if sock != nil {
+				sock.Close()
+			}
+
+			return nil, net.ErrClosed
+		}
+
+		if err == nil {
+			r.current = sock
+			r.setState(StateConnected, nil)
+			r.mu.Unlock()
+
+			return sock, nil
+		}
+
+		r.setState(StateDisconnected, err)
+		r.mu.Unlock()
+
+		if r.reconnect.MaxAttempts > 0 && attempt >= r.reconnect.MaxAttempts {
+			return nil, err
+		}
+
+		delay := r.backoff(attempt)
+
+		if !deadline.IsZero() && time.Now().Add(delay).After(deadline) {
+			return nil, err
+		}
+
+		timer := time.NewTimer(delay)
+
+		select {
+		case <-timer.C:
+		case <-r.closeCh:
+			timer.Stop()
+			return nil, net.ErrClosed
+		}
+	}
+}
+
+func (r *reconnectingSocket) dial() (Socket, error) {
+	conn, err := r.reconnect.Dial()
+	if err != nil {
+		return nil, err
+	}
+
+	sock := NewSocket(conn, r.options)
+
+	if r.reconnect.Handshake != nil {
+		if err := r.reconnect.Handshake(sock); err != nil {
+			sock.Close()
+			return nil, err
+		}
+	}
+
+	r.replayMu.Lock()
+	pending := append([]any(nil), r.pending...)
+	r.replayMu.Unlock()
+
+	for _, data := range pending {
+		if encoded, ok := data.(encodedObject); ok {
+			err = sock.WriteEncoded(encoded)
+		} else {
+			err = sock.Write(data)
+		}
+
+		if err != nil {
+			sock.Close()
+			return nil, err
+		}
+	}
+
+	return sock, nil
+}
+
+// Drop given socket if it's still the current one
+func (r *reconnectingSocket) drop(sock Socket, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.current != sock {
+		return
+	}
+
+	// Close first so that pending operations on the socket return and
+	// release its locks before its counters are collected
+	sock.Close()
+
+	r.read += sock.BytesRead()
+	r.written += sock.BytesWritten()
+	r.current = nil
+
+	if !r.closed {
+		r.setState(StateDisconnected, err)
+	}
+}
+
+func (r *reconnectingSocket) queue(data any) {
+	if !r.reconnect.Replay {
+		return
+	}
+
+	r.replayMu.Lock()
+	defer r.replayMu.Unlock()
+
+	r.pending = append(r.pending, data)
+
+	if limit := r.reconnect.ReplayLimit; limit > 0 && len(r.pending) > limit {
+		r.pending = append(r.pending[:0], r.pending[len(r.pending)-limit:]...)
+	}
+}
+
+// Reports whether err means the connection is no longer usable
+func isConnError(err error) bool {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, net.ErrClosed) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return !netErr.Timeout()
+	}
+
+	return false
+}
+
+func remaining(deadline time.Time) (time.Duration, error) {
+	timeout := time.Until(deadline)
+	if timeout <= 0 {
+		return 0, os.ErrDeadlineExceeded
+	}
+
+	return timeout, nil
+}
+
+func (r *reconnectingSocket) doRead(deadline time.Time) (any, error) {
+	for {
+		sock, err := r.conn(deadline)
+		if err != nil {
+			return nil, err
+		}
+
+		var data any
+
+		if deadline.IsZero() {
+			data, err = sock.Read()
+		} else {
+			var timeout time.Duration
+
+			if timeout, err = remaining(deadline); err != nil {
+				return nil, err
+			}
+
+			data, err = sock.ReadTimeout(timeout)
+		}
+
+		if err == nil || !isConnError(err) {
+			return data, err
+		}
+
+		r.drop(sock, err)
+	}
+}
+
+// Object written with WriteEncoded, kept as such in the replay queue
+type encodedObject []byte
+
+func (r *reconnectingSocket) doWrite(data any, deadline time.Time) error {
+	for {
+		sock, err := r.conn(deadline)
+		if err != nil {
+			return err
+		}
+
+		if encoded, ok := data.(encodedObject); ok {
+			err = sock.WriteEncoded(encoded)
+		} else if deadline.IsZero() {
+			err = sock.Write(data)
+		} else {
+			var timeout time.Duration
+
+			if timeout, err = remaining(deadline); err != nil {
+				return err
+			}
+
+			err = sock.WriteTimeout(data, timeout)
+		}
+
+		if err == nil {
+			r.queue(data)
+			return nil
+		}
+
+		if !isConnError(err) {
+			return err
+		}
+
+		r.drop(sock, err)
+	}
+}
+
+func (r *reconnectingSocket) Read() (any, error) {
+	if r.receiver.started.Load() {
+		return nil, ErrReaderStarted
+	}
+
+	r.rlock.Lock()
+	defer r.rlock.Unlock()
+
+	if r.receiver.started.Load() {
+		return nil, ErrReaderStarted
+	}
+
+	return r.doRead(time.Time{})
+}
+
+func (r *reconnectingSocket) Write(data any) error {
+	return r.doWrite(data, time.Time{})
+}
+
+func (r *reconnectingSocket) WriteEncoded(data []byte) error {
+	// Copied since it may be kept for replay
+	if r.reconnect.Replay {
+		data = append([]byte(nil), data...)
+	}
+
+	return r.doWrite(encodedObject(data), time.Time{})
+}
+
+func (r *reconnectingSocket) ReadTimeout(timeout time.Duration) (any, error) {
+	if r.receiver.started.Load() {
+		return nil, ErrReaderStarted
+	}
+
+	r.rlock.Lock()
+	defer r.rlock.Unlock()
+
+	if r.receiver.started.Load() {
+		return nil, ErrReaderStarted
+	}
+
+	return r.doRead(time.Now().Add(timeout))
+}
+
+func (r *reconnectingSocket) WriteTimeout(data any, timeout time.Duration) error {
+	return r.doWrite(data, time.Now().Add(timeout))
+}
+
+func (r *reconnectingSocket) Close() error {
+	r.receiver.stop()
+
+	r.closeOnce.Do(func() {
+		close(r.closeCh)
+	})
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return nil
+	}
+
+	r.closed = true
+
+	var err error
+
+	if r.current != nil {
+		err = r.current.Close()
+		r.read += r.current.BytesRead()
+		r.written += r.current.BytesWritten()
+		r.current = nil
+	}
+
+	r.setState(StateClosed, nil)
+
+	return err
+}
+
+func (r *reconnectingSocket) Ack() {
+	r.replayMu.Lock()
+	defer r.replayMu.Unlock()
+
+	r.pending = nil
+}
+
+func (r *reconnectingSocket) State() ConnState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.state
+}
+
+// Get current socket without holding the lock while using it, since its
+// methods may block on a pending Read/Write
+func (r *reconnectingSocket) snapshot() (current Socket, read, written uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.current, r.read, r.written
+}
+
+func (r *reconnectingSocket) BytesRead() uint64 {
+	current, read, _ := r.snapshot()
+
+	if current != nil {
+		read += current.BytesRead()
+	}
+
+	return read
+}
+
+func (r *reconnectingSocket) BytesWritten() uint64 {
+	current, _, written := r.snapshot()
+
+	if current != nil {
+		written += current.BytesWritten()
+	}
+
+	return written
+}
+
+func (r *reconnectingSocket) ResetRead() {
+	r.mu.Lock()
+	r.read = 0
+	current := r.current
+	r.mu.Unlock()
+
+	if current != nil {
+		current.ResetRead()
+	}
+}
+
+func (r *reconnectingSocket) ResetWritten() {
+	r.mu.Lock()
+	r.written = 0
+	current := r.current
+	r.mu.Unlock()
+
+	if current != nil {
+		current.ResetWritten()
+	}
+}
+
+func (r *reconnectingSocket) ZeroBuffer() {
+	if current, _, _ := r.snapshot(); current != nil {
+		current.ZeroBuffer()
+	}
+}
+
+func (r *reconnectingSocket) readBlocking() (any, error) {
+	r.rlock.Lock()
+	defer r.rlock.Unlock()
+
+	return r.doRead(time.Time{})
+}
+
+func (r *reconnectingSocket) Incoming() <-chan any {
+	r.receiver.start(r.options.IncomingBuffer, r.readBlocking)
+
+	return r.receiver.incoming
+}
+
+func (r *reconnectingSocket) Err() <-chan error {
+	r.receiver.start(r.options.IncomingBuffer, r.readBlocking)
+
+	return r.receiver.errs
+}
+
+func (r *reconnectingSocket) PeerInfo() PeerInfo {
+	if current, _, _ := r.snapshot(); current != nil {
+		return current.PeerInfo()
+	}
+
+	return PeerInfo{}
+}
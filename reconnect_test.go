@@ -0,0 +1,238 @@
+package pack
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReconnectingSocket(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	type objectA struct {
+		String string
+	}
+
+	type objectB struct {
+		String string
+	}
+
+	var (
+		options = Options{
+			WithObjects: NewObjects(
+				objectA{},
+				objectB{},
+			),
+		}
+
+		wg sync.WaitGroup
+
+		testError error
+
+		statesMu sync.Mutex
+		states   []ConnState
+	)
+
+	wg.Add(1)
+
+	// Server, drops the first connection right after reading from it, and
+	// answers on the second one
+	go func() {
+		defer wg.Done()
+
+		for i := 0; i < 2; i++ {
+			conn, err := listener.Accept()
+			if err != nil {
+				testError = err
+				return
+			}
+
+			socketServer := NewSocket(conn, options)
+
+			obj, err := socketServer.ReadTimeout(time.Second)
+			if err != nil {
+				testError = err
+				conn.Close()
+				return
+			}
+
+			if o, ok := obj.(*objectA); !ok || o.String != "Hello" {
+				testError = fmt.Errorf("expected to receive replayed *objectA, got %+v", obj)
+				conn.Close()
+				return
+			}
+
+			if i == 1 {
+				err = socketServer.WriteTimeout(objectB{String: "World"}, time.Second)
+				if err != nil {
+					testError = err
+				}
+			}
+
+			conn.Close()
+		}
+	}()
+
+	socketClient := NewReconnectingSocket(options, ReconnectOptions{
+		Dial: func() (net.Conn, error) {
+			return net.Dial("tcp", listener.Addr().String())
+		},
+		MinBackoff: time.Millisecond,
+		Replay:     true,
+		OnStateChange: func(state ConnState, err error) {
+			statesMu.Lock()
+			defer statesMu.Unlock()
+
+			states = append(states, state)
+		},
+	})
+
+	err = socketClient.WriteTimeout(objectA{String: "Hello"}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj, err := socketClient.ReadTimeout(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if o, ok := obj.(*objectB); !ok || o.String != "World" {
+		t.Errorf("expected to receive *objectB after reconnecting, got %+v", obj)
+	}
+
+	wg.Wait()
+
+	if testError != nil {
+		t.Error(testError)
+	}
+
+	socketClient.Close()
+
+	if socketClient.State() != StateClosed {
+		t.Errorf("expected state to be %s after Close, got %s", StateClosed, socketClient.State())
+	}
+
+	expect := []ConnState{
+		StateConnecting, StateConnected, StateDisconnected,
+		StateConnecting, StateConnected, StateClosed,
+	}
+
+	statesMu.Lock()
+	defer statesMu.Unlock()
+
+	if !reflect.DeepEqual(states, expect) {
+		t.Errorf("expected state changes to be %v, got %v", expect, states)
+	}
+}
+
+func TestReconnectingSocketMaxAttempts(t *testing.T) {
+
+	t.Parallel()
+
+	var (
+		attempts int
+
+		dialErr = fmt.Errorf("dial failed")
+
+		socket = NewReconnectingSocket(Options{WithObjects: NewObjects()}, ReconnectOptions{
+			Dial: func() (net.Conn, error) {
+				attempts++
+				return nil, dialErr
+			},
+			MinBackoff:  time.Millisecond,
+			MaxAttempts: 3,
+		})
+	)
+
+	defer socket.Close()
+
+	_, err := socket.Read()
+	if err != dialErr {
+		t.Errorf("expected socket.Read() to return the dial error, got %v", err)
+	}
+
+	if attempts != 3 {
+		t.Errorf("expected 3 dial attempts, got %d", attempts)
+	}
+}
+
+func TestReconnectingSocketCloseWhileDialing(t *testing.T) {
+
+	t.Parallel()
+
+	var (
+		dialing = make(chan struct{})
+		release = make(chan struct{})
+
+		socket = NewReconnectingSocket(Options{WithObjects: NewObjects()}, ReconnectOptions{
+			Dial: func() (net.Conn, error) {
+				close(dialing)
+				<-release
+				return nil, fmt.Errorf("dial failed")
+			},
+			Jitter: 5,
+		})
+
+		readErr = make(chan error, 1)
+	)
+
+	defer close(release)
+
+	go func() {
+		_, err := socket.Read()
+		readErr <- err
+	}()
+
+	<-dialing
+
+	var done = make(chan struct{})
+
+	go func() {
+		socket.State()
+		socket.BytesRead()
+		socket.Close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected State, BytesRead and Close not to wait on a hanging Dial")
+	}
+
+	release <- struct{}{}
+
+	select {
+	case err := <-readErr:
+		if err != net.ErrClosed {
+			t.Errorf("expected socket.Read() to return net.ErrClosed after Close, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected socket.Read() to return after Close")
+	}
+}
+
+func TestReconnectingSocketJitter(t *testing.T) {
+
+	t.Parallel()
+
+	var socket = NewReconnectingSocket(Options{WithObjects: NewObjects()}, ReconnectOptions{
+		Dial:       func() (net.Conn, error) { return nil, fmt.Errorf("dial failed") },
+		MinBackoff: time.Second,
+		Jitter:     5,
+	}).(*reconnectingSocket)
+
+	for i := 0; i < 100; i++ {
+		if delay := socket.backoff(1); delay < 0 || delay > 2*time.Second {
+			t.Fatalf("expected jitter to be clamped to 1, got a delay of %s", delay)
+		}
+	}
+}
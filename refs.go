@@ -0,0 +1,102 @@
+package pack
+
+import "reflect"
+
+// Reference headers written before pointers, maps and slices when
+// references are preserved, see Options.PreserveReferences
+const (
+	refNil = iota
+	refNew
+
+	// Headers from refFirstID on are back-references to the value with ID
+	// header - refFirstID, IDs are given in the order values are first met
+	refFirstID
+)
+
+// Identity of a pointer, map or slice, the type tells apart values at the
+// same address such as a struct and its first field
+type refKey struct {
+	ptr uintptr
+	len int
+	typ reflect.Type
+}
+
+// Write the reference header of a pointer, map or slice, done reports whether
+// its contents must not be encoded as it's nil or was already encoded
+func (p *packer) encodeRef(val reflect.Value) (done bool, err error) {
+	if val.IsNil() {
+		return true, p.writeVarUint(refNil)
+	}
+
+	var key = refKey{ptr: val.Pointer(), typ: val.Type()}
+
+	if val.Kind() == reflect.Slice {
+		key.len = val.Len()
+	}
+
+	if id, ok := p.refs[key]; ok {
+		return true, p.writeVarUint(refFirstID + id)
+	}
+
+	if p.refs == nil {
+		p.refs = map[refKey]uint64{}
+	}
+
+	// Empty slices may all share the same address, so they are never
+	// referenced, their IDs are still used up to stay in sync with decoding
+	if val.Kind() != reflect.Slice || key.len > 0 {
+		p.refs[key] = p.nextRef
+	}
+
+	p.nextRef++
+
+	return false, p.writeVarUint(refNew)
+}
+
+// Read the reference header of a pointer, map or slice, done reports whether
+// val was set from it and its contents must not be decoded, otherwise id is
+// the ID to register val under once it's allocated
+func (u *unpacker) decodeRef(val reflect.Value) (done bool, id int, err error) {
+	var header uint64
+
+	n, err := ReadVarUint(u.reader, &header, u.buffer[:])
+	u.read += uint64(n)
+	if err != nil {
+		return true, 0, err
+	}
+
+	switch header {
+	case refNil:
+		val.SetZero()
+		return true, 0, nil
+
+	case refNew:
+		u.refs = append(u.refs, reflect.Value{})
+		return false, len(u.refs) - 1, nil
+	}
+
+	header -= refFirstID
+
+	if header >= uint64(len(u.refs)) || !u.refs[header].IsValid() || u.refs[header].Type() != val.Type() {
+		return true, 0, ErrInvalidReference
+	}
+
+	val.Set(u.refs[header])
+
+	return true, 0, nil
+}
+
+// Give an Object the next ID without writing a header, as Objects are never
+// nil or back-references, ptr is the pointer it was given through, if any,
+// so references to it resolve to the decoded Object
+func (p *packer) registerObject(ptr reflect.Value) {
+	if ptr.IsValid() {
+		if p.refs == nil {
+			p.refs = map[refKey]uint64{}
+		}
+
+		p.refs[refKey{ptr: ptr.Pointer(), typ: ptr.Type()}] = p.nextRef
+	}
+
+	p.nextRef++
+}
@@ -3,7 +3,13 @@ package pack
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"math"
 	"net"
+	"os"
 	"sync"
 	"time"
 )
@@ -21,6 +27,14 @@ type Socket interface {
 	// Write object to socket with a timeout
 	WriteTimeout(data any, timeout time.Duration) error
 
+	// Write an object that was already packed with Marshal using the same
+	// Options as the socket, without packing it again, useful for sending
+	// the same object to many sockets
+	//
+	// Objects larger than Options.SizeLimit are not written, returning
+	// ErrDataTooLarge
+	WriteEncoded(data []byte) error
+
 	// Close socket
 	Close() error
 
@@ -38,10 +52,42 @@ type Socket interface {
 
 	// Deallocate write buffer to free memory
 	ZeroBuffer()
+
+	// Start an internal reader, if not already started, and get the channel
+	// decoded objects are delivered to, the channel is closed once the reader
+	// stops
+	//
+	// Once the internal reader is started, Read and ReadTimeout will return
+	// ErrReaderStarted
+	Incoming() <-chan any
+
+	// Start an internal reader, if not already started, and get the channel
+	// that receives the error that stopped it, the channel is closed without
+	// receiving any error if the reader stopped because the socket was closed
+	Err() <-chan error
+
+	// Get information about the other side of the connection, such as the
+	// certificate it identified itself with over TLS
+	//
+	// Sockets accepted over TLS complete the handshake lazily, if it has not
+	// completed yet PeerInfo runs it, blocking for up to 10 seconds while the
+	// peer takes part, so call it from the goroutine serving the connection
+	// rather than from Accept loops
+	PeerInfo() PeerInfo
+}
+
+// Implemented by transports that support read and write deadlines,
+// such as net.Conn and pollable *os.File
+type deadliner interface {
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
 }
 
 type socket struct {
-	conn net.Conn
+	conn io.ReadWriteCloser
+
+	// Nil if conn does not support deadlines
+	deadlines deadliner
 
 	writeBuffer    *bytes.Buffer
 	bufferedReader *bufio.Reader
@@ -52,62 +98,287 @@ type socket struct {
 	wlock sync.Mutex
 	rlock sync.Mutex
 
+	receiver       *receiver
+	incomingBuffer int
+
 	// For the socket implementation, bytes written may differ from
 	// packer.BytesWritten(), since if packer.Encode() errors, no bytes
 	// will be written to the socket.
 	written uint64
+
+	// Limit of objects written with WriteEncoded, as the packer enforces it
+	// on everything else
+	sizeLimit uint64
+
+	// Only set when conn is a *net.UnixConn able to pass files
+	unixConn   *net.UnixConn
+	readFiles  *fileTable
+	writeFiles *fileTable
+
+	// Nil unless Options.WithStats is set
+	stats   StatsCollector
+	objects Objects
+	waits   *waitTimer
 }
 
+// Measures the time spent blocked reading from a stream, so it can be left
+// out of the time spent decoding
+type waitTimer struct {
+	io.Reader
+
+	waited time.Duration
+}
+
+func (w *waitTimer) Read(b []byte) (int, error) {
+	start := time.Now()
+	n, err := w.Reader.Read(b)
+	w.waited += time.Since(start)
+
+	return n, err
+}
+
+// Create a Socket over a network connection
+//
+// When conn is a *net.UnixConn on a unix system, values of type *os.File,
+// net.Conn and net.Listener within objects are passed to the other side as
+// file descriptors (SCM_RIGHTS), the receiving side gets new descriptors
+// for the same open files, connections and listeners
 func NewSocket(conn net.Conn, options Options) Socket {
+	return newSocket(conn, options)
+}
+
+// Create a Socket over any stream, such as pipes, serial ports or SSH channels
+//
+// If the stream does not support deadlines (by implementing SetReadDeadline
+// and SetWriteDeadline, like *os.File does), ReadTimeout and WriteTimeout
+// will return ErrTimeoutUnsupported
+func NewStreamSocket(stream io.ReadWriteCloser, options Options) Socket {
+	return newSocket(stream, options)
+}
+
+func newSocket(conn io.ReadWriteCloser, options Options) *socket {
 	if options.WithObjects == nil {
 		panic("WithObjects may not be nil in Socket")
 	}
 
+	var (
+		source io.Reader = conn
+
+		unixConn              *net.UnixConn
+		readFiles, writeFiles *fileTable
+	)
+
+	if uc, ok := conn.(*net.UnixConn); ok && canPassFiles {
+		unixConn = uc
+		readFiles, writeFiles = &fileTable{}, &fileTable{}
+		source = newFileReader(uc, readFiles)
+	}
+
+	var waits *waitTimer
+
+	if options.WithStats != nil {
+		waits = &waitTimer{Reader: source}
+		source = waits
+	}
+
 	var (
 		writeBuffer    = bytes.NewBuffer(nil)
-		bufferedReader = bufio.NewReader(conn)
+		bufferedReader = bufio.NewReader(source)
+
+		u = NewUnpacker(bufferedReader, options)
+		p = NewPacker(writeBuffer, options)
 	)
 
+	u.(*unpacker).files = readFiles
+	p.(*packer).files = writeFiles
+
+	deadlines, _ := conn.(deadliner)
+
 	return &socket{
-		conn: conn,
+		conn:      conn,
+		deadlines: deadlines,
 
 		writeBuffer:    writeBuffer,
 		bufferedReader: bufferedReader,
 
-		unpacker: NewUnpacker(bufferedReader, options),
-		packer:   NewPacker(writeBuffer, options),
+		unpacker: u,
+		packer:   p,
+
+		receiver:       newReceiver(),
+		incomingBuffer: options.IncomingBuffer,
+
+		sizeLimit: options.SizeLimit,
+
+		unixConn:   unixConn,
+		readFiles:  readFiles,
+		writeFiles: writeFiles,
+
+		stats:   options.WithStats,
+		objects: options.WithObjects,
+		waits:   waits,
 	}
 }
 
-func (s *socket) read() (any, error) {
-	var receiver any
+func (s *socket) read() (receiver any, err error) {
+	if s.readFiles != nil {
+		before := s.unpacker.BytesRead()
+
+		defer func() {
+			s.readFiles.finish(s.readFiles.pos+s.unpacker.BytesRead()-before, err != nil)
+		}()
+	}
+
+	if s.stats == nil {
+		if err := s.unpacker.Decode(&receiver); err != nil {
+			return nil, err
+		}
+
+		return receiver, nil
+	}
+
+	var (
+		start  = time.Now()
+		before = s.unpacker.BytesRead()
+	)
+
+	s.waits.waited = 0
 
 	if err := s.unpacker.Decode(&receiver); err != nil {
 		return nil, err
 	}
 
+	// Time spent waiting for the message to arrive is not decoding
+	duration := time.Since(start) - s.waits.waited
+
+	recordStats(s.stats, s.objects, DirectionRead, receiver, s.unpacker.BytesRead()-before, duration)
+
 	return receiver, nil
 }
 
 func (s *socket) write(data any) error {
 	s.writeBuffer.Reset()
 
+	if s.writeFiles != nil {
+		defer s.writeFiles.reset()
+	}
+
+	var start time.Time
+
+	if s.stats != nil {
+		start = time.Now()
+	}
+
 	if err := s.packer.Encode(data); err != nil {
 		return err
 	}
 
-	n, err := s.conn.Write(s.writeBuffer.Bytes())
+	var (
+		n   int
+		err error
+
+		duration time.Duration
+	)
+
+	if s.stats != nil {
+		duration = time.Since(start)
+	}
+
+	if s.writeFiles != nil && len(s.writeFiles.files) > 0 {
+		n, err = writeWithFiles(s.unixConn, s.writeBuffer.Bytes(), s.writeFiles.files)
+	} else {
+		n, err = s.conn.Write(s.writeBuffer.Bytes())
+	}
 
 	s.written += uint64(n)
 
+	if s.stats != nil && err == nil {
+		recordStats(s.stats, s.objects, DirectionWrite, data, uint64(n), duration)
+	}
+
+	return err
+}
+
+func recordStats(stats StatsCollector, objects Objects, dir Direction, data any, bytes uint64, duration time.Duration) {
+	id, _ := objects.GetID(data)
+
+	stats.Record(dir, id, bytes, duration)
+}
+
+// Check an object given to WriteEncoded against the size limit of a Socket
+func checkEncodedSize(sizeLimit uint64, data []byte) error {
+	if sizeLimit > 0 && uint64(len(data)) > sizeLimit {
+		return &ErrDataTooLarge{max: sizeLimit, size: uint64(len(data))}
+	}
+
+	return nil
+}
+
+// Record an object written with WriteEncoded, which took no time to encode
+func recordEncodedStats(stats StatsCollector, data []byte) {
+	// Packed objects start with their Object ID
+	id, _, _ := GetVarUint(data)
+
+	stats.Record(DirectionWrite, uint(id), uint64(len(data)), 0)
+}
+
+// Treat streams without deadline support as unsupported only when a
+// deadline is actually being set
+func deadlineError(err error, t time.Time) error {
+	if errors.Is(err, os.ErrNoDeadline) {
+		if t.IsZero() {
+			return nil
+		}
+
+		return ErrTimeoutUnsupported
+	}
+
 	return err
 }
 
+func (s *socket) setReadDeadline(t time.Time) error {
+	if s.deadlines == nil {
+		return deadlineError(os.ErrNoDeadline, t)
+	}
+
+	return deadlineError(s.deadlines.SetReadDeadline(t), t)
+}
+
+func (s *socket) setWriteDeadline(t time.Time) error {
+	if s.deadlines == nil {
+		return deadlineError(os.ErrNoDeadline, t)
+	}
+
+	return deadlineError(s.deadlines.SetWriteDeadline(t), t)
+}
+
+func (s *socket) readBlocking() (any, error) {
+	s.rlock.Lock()
+	defer s.rlock.Unlock()
+
+	if err := s.setReadDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+
+	return s.read()
+}
+
 func (s *socket) Read() (any, error) {
+	// Checked before taking the read lock too, as the internal reader holds
+	// it while waiting for the next object
+	if s.receiver.started.Load() {
+		return nil, ErrReaderStarted
+	}
+
 	s.rlock.Lock()
 	defer s.rlock.Unlock()
 
-	if err := s.conn.SetReadDeadline(time.Time{}); err != nil {
+	// Checked under the read lock, so no read may share the stream with the
+	// internal reader once it started
+	if s.receiver.started.Load() {
+		return nil, ErrReaderStarted
+	}
+
+	if err := s.setReadDeadline(time.Time{}); err != nil {
 		return nil, err
 	}
 
@@ -118,18 +389,49 @@ func (s *socket) Write(data any) error {
 	s.wlock.Lock()
 	defer s.wlock.Unlock()
 
-	if err := s.conn.SetWriteDeadline(time.Time{}); err != nil {
+	if err := s.setWriteDeadline(time.Time{}); err != nil {
 		return err
 	}
 
 	return s.write(data)
 }
 
+func (s *socket) WriteEncoded(data []byte) error {
+	if err := checkEncodedSize(s.sizeLimit, data); err != nil {
+		return err
+	}
+
+	s.wlock.Lock()
+	defer s.wlock.Unlock()
+
+	if err := s.setWriteDeadline(time.Time{}); err != nil {
+		return err
+	}
+
+	n, err := s.conn.Write(data)
+
+	s.written += uint64(n)
+
+	if s.stats != nil && err == nil {
+		recordEncodedStats(s.stats, data)
+	}
+
+	return err
+}
+
 func (s *socket) ReadTimeout(timeout time.Duration) (any, error) {
+	if s.receiver.started.Load() {
+		return nil, ErrReaderStarted
+	}
+
 	s.rlock.Lock()
 	defer s.rlock.Unlock()
 
-	if err := s.conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+	if s.receiver.started.Load() {
+		return nil, ErrReaderStarted
+	}
+
+	if err := s.setReadDeadline(time.Now().Add(timeout)); err != nil {
 		return nil, err
 	}
 
@@ -140,7 +442,7 @@ func (s *socket) WriteTimeout(data any, timeout time.Duration) error {
 	s.wlock.Lock()
 	defer s.wlock.Unlock()
 
-	if err := s.conn.SetWriteDeadline(time.Now().Add(timeout)); err != nil {
+	if err := s.setWriteDeadline(time.Now().Add(timeout)); err != nil {
 		return err
 	}
 
@@ -148,7 +450,18 @@ func (s *socket) WriteTimeout(data any, timeout time.Duration) error {
 }
 
 func (s *socket) Close() error {
-	return s.conn.Close()
+	s.receiver.stop()
+
+	err := s.conn.Close()
+
+	if s.readFiles != nil {
+		// Files received with messages that were never decoded
+		s.rlock.Lock()
+		s.readFiles.finish(math.MaxUint64, false)
+		s.rlock.Unlock()
+	}
+
+	return err
 }
 
 func (s *socket) BytesRead() uint64 {
@@ -184,5 +497,42 @@ func (s *socket) ZeroBuffer() {
 	s.wlock.Lock()
 	defer s.wlock.Unlock()
 
-	s.writeBuffer = bytes.NewBuffer(nil)
+	// Replace the buffer in place, since the packer holds a pointer to it
+	*s.writeBuffer = bytes.Buffer{}
+}
+
+func (s *socket) Incoming() <-chan any {
+	s.receiver.start(s.incomingBuffer, s.readBlocking)
+
+	return s.receiver.incoming
+}
+
+func (s *socket) Err() <-chan error {
+	s.receiver.start(s.incomingBuffer, s.readBlocking)
+
+	return s.receiver.errs
+}
+
+func (s *socket) PeerInfo() PeerInfo {
+	var info PeerInfo
+
+	if conn, ok := s.conn.(net.Conn); ok {
+		info.RemoteAddr = conn.RemoteAddr()
+	}
+
+	if conn, ok := s.conn.(*tls.Conn); ok {
+		// Accepted connections complete the handshake lazily, finish it so the
+		// peer's identity is known, dropping clients that take too long
+		if !conn.ConnectionState().HandshakeComplete {
+			ctx, cancel := context.WithTimeout(context.Background(), tlsHandshakeTimeout)
+			conn.HandshakeContext(ctx)
+			cancel()
+		}
+
+		if state := conn.ConnectionState(); state.HandshakeComplete {
+			info.TLS = &state
+		}
+	}
+
+	return info
 }
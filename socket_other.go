@@ -0,0 +1,19 @@
+//go:build !unix
+
+package pack
+
+import (
+	"io"
+	"net"
+	"os"
+)
+
+const canPassFiles = false
+
+func newFileReader(conn *net.UnixConn, files *fileTable) io.Reader {
+	return conn
+}
+
+func writeWithFiles(conn *net.UnixConn, b []byte, files []*os.File) (int, error) {
+	return 0, &ErrFilesUnsupported{typ: typeFile}
+}
@@ -1,7 +1,9 @@
 package pack
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"reflect"
 	"sync"
@@ -118,3 +120,261 @@ func TestSocket(t *testing.T) {
 		t.Error(testError)
 	}
 }
+
+func TestSocketIncoming(t *testing.T) {
+
+	t.Parallel()
+
+	type object struct {
+		Value int
+	}
+
+	var (
+		options = Options{
+			WithObjects:    NewObjects(object{}),
+			IncomingBuffer: 1,
+		}
+
+		connServer, connClient = net.Pipe()
+
+		socketServer = NewSocket(connServer, options)
+		socketClient = NewSocket(connClient, options)
+	)
+
+	go func() {
+		for i := 0; i < 3; i++ {
+			socketServer.Write(object{Value: i})
+		}
+		socketServer.Close()
+	}()
+
+	var received []int
+
+	for obj := range socketClient.Incoming() {
+		received = append(received, obj.(*object).Value)
+	}
+
+	if !reflect.DeepEqual(received, []int{0, 1, 2}) {
+		t.Errorf("expected to receive values [0 1 2] from socket.Incoming(), got %v", received)
+	}
+
+	if err := <-socketClient.Err(); err == nil {
+		t.Error("expected socket.Err() to receive an error after the remote end was closed")
+	}
+
+	if _, err := socketClient.Read(); err != ErrReaderStarted {
+		t.Errorf("expected socket.Read() to return ErrReaderStarted, got %v", err)
+	}
+}
+
+func TestSocketIncomingWhileReading(t *testing.T) {
+
+	t.Parallel()
+
+	type object struct {
+		Value int
+	}
+
+	var (
+		options = Options{
+			WithObjects: NewObjects(object{}),
+		}
+
+		connServer, connClient = net.Pipe()
+
+		socketServer = NewSocket(connServer, options)
+		socketClient = NewSocket(connClient, options)
+
+		readResult = make(chan any, 1)
+	)
+
+	defer socketServer.Close()
+	defer socketClient.Close()
+
+	// Either gets the first object or ErrReaderStarted, depending on whether
+	// it took the read lock before the internal reader started
+	go func() {
+		obj, err := socketClient.Read()
+		if err != nil {
+			readResult <- err
+		} else {
+			readResult <- obj
+		}
+	}()
+
+	incoming := socketClient.Incoming()
+
+	go func() {
+		for i := 0; i < 3; i++ {
+			socketServer.Write(object{Value: i})
+		}
+	}()
+
+	var (
+		received = map[int]int{}
+		expected = 3
+	)
+
+	switch result := (<-readResult).(type) {
+	case *object:
+		received[result.Value]++
+		expected--
+	case error:
+		if result != ErrReaderStarted {
+			t.Fatalf("expected in-flight socket.Read() to return an object or ErrReaderStarted, got %v", result)
+		}
+	}
+
+	for i := 0; i < expected; i++ {
+		select {
+		case obj := <-incoming:
+			received[obj.(*object).Value]++
+		case <-time.After(time.Second):
+			t.Fatalf("expected to receive %d objects from socket.Incoming(), got %d", expected, i)
+		}
+	}
+
+	if !reflect.DeepEqual(received, map[int]int{0: 1, 1: 1, 2: 1}) {
+		t.Errorf("expected every object to be received exactly once, got %v", received)
+	}
+
+	if _, err := socketClient.Read(); err != ErrReaderStarted {
+		t.Errorf("expected socket.Read() to return ErrReaderStarted, got %v", err)
+	}
+}
+
+func TestSocketIncomingClose(t *testing.T) {
+
+	t.Parallel()
+
+	var (
+		options = Options{
+			WithObjects: NewObjects(),
+		}
+
+		connServer, connClient = net.Pipe()
+
+		socketClient = NewSocket(connClient, options)
+	)
+
+	defer connServer.Close()
+
+	incoming := socketClient.Incoming()
+
+	socketClient.Close()
+
+	select {
+	case err, ok := <-socketClient.Err():
+		if ok {
+			t.Errorf("expected socket.Err() to be closed without error after Close, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected internal reader to stop after Close")
+	}
+
+	if _, ok := <-incoming; ok {
+		t.Error("expected socket.Incoming() to be closed after Close")
+	}
+}
+
+type pipeStream struct {
+	io.Reader
+	io.WriteCloser
+}
+
+func TestSocketWriteEncodedSizeLimit(t *testing.T) {
+
+	t.Parallel()
+
+	type object struct {
+		String string
+	}
+
+	var (
+		options = Options{
+			WithObjects: NewObjects(object{}),
+			SizeLimit:   16,
+		}
+
+		conn, _      = net.Pipe()
+		pipeA, pipeB = NewPipe(options)
+	)
+
+	defer conn.Close()
+	defer pipeA.Close()
+
+	encoded, err := Marshal(object{String: "Hello, World! Hello, World!"}, Options{WithObjects: options.WithObjects})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, socket := range []Socket{NewSocket(conn, options), pipeA} {
+		var dataTooLarge *ErrDataTooLarge
+
+		if err := socket.WriteEncoded(encoded); !errors.As(err, &dataTooLarge) {
+			t.Errorf("expected %T to reject object over SizeLimit with ErrDataTooLarge, got %v", socket, err)
+		}
+
+		if socket.BytesWritten() != 0 {
+			t.Errorf("expected %T to write nothing, wrote %d bytes", socket, socket.BytesWritten())
+		}
+	}
+
+	small, err := Marshal(object{String: "Hi"}, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := pipeA.WriteEncoded(small); err != nil {
+		t.Fatal(err)
+	}
+
+	if obj, err := pipeB.ReadTimeout(time.Second); err != nil {
+		t.Error(err)
+	} else if o, ok := obj.(*object); !ok || o.String != "Hi" {
+		t.Errorf("expected to receive *object with String \"Hi\", got %+v", obj)
+	}
+}
+
+func TestStreamSocket(t *testing.T) {
+
+	t.Parallel()
+
+	type object struct {
+		String string
+	}
+
+	var (
+		options = Options{
+			WithObjects: NewObjects(object{}),
+		}
+
+		readerA, writerB = io.Pipe()
+		readerB, writerA = io.Pipe()
+
+		socketA = NewStreamSocket(pipeStream{readerA, writerA}, options)
+		socketB = NewStreamSocket(pipeStream{readerB, writerB}, options)
+	)
+
+	defer socketA.Close()
+	defer socketB.Close()
+
+	go socketA.Write(object{String: "Hello, World!"})
+
+	obj, err := socketB.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if o, ok := obj.(*object); !ok || o.String != "Hello, World!" {
+		t.Errorf("expected to receive *object with String \"Hello, World!\", got %+v", obj)
+	}
+
+	if _, err = socketB.ReadTimeout(time.Second); err != ErrTimeoutUnsupported {
+		t.Errorf("expected socket.ReadTimeout() to return ErrTimeoutUnsupported, got %v", err)
+	}
+
+	if err = socketB.WriteTimeout(object{}, time.Second); err != ErrTimeoutUnsupported {
+		t.Errorf("expected socket.WriteTimeout() to return ErrTimeoutUnsupported, got %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+//go:build unix
+
+package pack
+
+import (
+	"io"
+	"net"
+	"os"
+	"syscall"
+)
+
+const canPassFiles = true
+
+// Maximum amount of file descriptors passed in a single message (SCM_MAX_FD)
+const maxPassedFiles = 253
+
+// Reads from a *net.UnixConn, collecting file descriptors received as
+// ancillary data
+type fileReader struct {
+	conn  *net.UnixConn
+	files *fileTable
+	oob   []byte
+
+	// Amount of bytes read so far
+	offset uint64
+}
+
+func newFileReader(conn *net.UnixConn, files *fileTable) io.Reader {
+	return &fileReader{
+		conn:  conn,
+		files: files,
+		oob:   make([]byte, syscall.CmsgSpace(maxPassedFiles*4)),
+	}
+}
+
+func (r *fileReader) Read(b []byte) (int, error) {
+	n, oobn, _, _, err := r.conn.ReadMsgUnix(b, r.oob)
+
+	var files []*os.File
+
+	if oobn > 0 {
+		msgs, perr := syscall.ParseSocketControlMessage(r.oob[:oobn])
+		if perr != nil && err == nil {
+			err = perr
+		}
+
+		for i := range msgs {
+			fds, perr := syscall.ParseUnixRights(&msgs[i])
+			if perr != nil {
+				continue
+			}
+
+			for _, fd := range fds {
+				files = append(files, os.NewFile(uintptr(fd), "unix-rights"))
+			}
+		}
+	}
+
+	if len(files) > 0 {
+		r.files.receive(r.offset, n, files)
+	}
+
+	r.offset += uint64(n)
+
+	return n, err
+}
+
+// Write b to conn, passing files along with it
+func writeWithFiles(conn *net.UnixConn, b []byte, files []*os.File) (int, error) {
+	var (
+		n   int
+		err error
+	)
+
+	err = withFds(files, nil, func(fds []int) error {
+		n, _, err = conn.WriteMsgUnix(b, syscall.UnixRights(fds...), nil)
+		return err
+	})
+
+	if err == nil && n < len(b) {
+		var m int
+		m, err = conn.Write(b[n:])
+		n += m
+	}
+
+	return n, err
+}
+
+// Call fn with the raw descriptors of files, which are guaranteed to remain
+// valid until fn returns
+func withFds(files []*os.File, fds []int, fn func(fds []int) error) error {
+	if len(files) == 0 {
+		return fn(fds)
+	}
+
+	raw, err := files[0].SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var fnErr error
+
+	err = raw.Control(func(fd uintptr) {
+		fnErr = withFds(files[1:], append(fds, int(fd)), fn)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return fnErr
+}
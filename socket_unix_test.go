@@ -0,0 +1,236 @@
+//go:build unix
+
+package pack
+
+import (
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func unixConnPair(t *testing.T) (*net.UnixConn, *net.UnixConn) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var conns [2]*net.UnixConn
+
+	for i, fd := range fds {
+		file := os.NewFile(uintptr(fd), "socketpair")
+
+		conn, err := net.FileConn(file)
+		file.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		conns[i] = conn.(*net.UnixConn)
+	}
+
+	return conns[0], conns[1]
+}
+
+func TestSocketPassFiles(t *testing.T) {
+
+	t.Parallel()
+
+	type message struct {
+		Name     string
+		File     *os.File
+		Missing  *os.File
+		Listener net.Listener
+	}
+
+	var (
+		options = Options{
+			WithObjects: NewObjects(message{}),
+		}
+
+		connA, connB = unixConnPair(t)
+
+		socketA = NewSocket(connA, options)
+		socketB = NewSocket(connB, options)
+	)
+
+	defer socketA.Close()
+	defer socketB.Close()
+
+	file, err := os.CreateTemp(t.TempDir(), "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if _, err = file.WriteString("Hello, World!"); err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	err = socketA.WriteTimeout(message{Name: "files", File: file, Listener: listener}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj, err := socketB.ReadTimeout(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, ok := obj.(*message)
+	if !ok {
+		t.Fatalf("expected to receive *message, got %+v", obj)
+	}
+
+	if msg.Name != "files" || msg.Missing != nil {
+		t.Errorf("expected regular fields to be decoded as sent, got %+v", msg)
+	}
+
+	if msg.File == nil || msg.Listener == nil {
+		t.Fatalf("expected File and Listener to be received, got %+v", msg)
+	}
+	defer msg.File.Close()
+	defer msg.Listener.Close()
+
+	content, err := io.ReadAll(io.NewSectionReader(msg.File, 0, 1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(content) != "Hello, World!" {
+		t.Errorf("expected received file to contain \"Hello, World!\", got %q", content)
+	}
+
+	if msg.Listener.Addr().String() != listener.Addr().String() {
+		t.Errorf("expected received listener to listen on %s, got %s", listener.Addr(), msg.Listener.Addr())
+	}
+}
+
+func TestSocketPassFilesUnreferenced(t *testing.T) {
+
+	t.Parallel()
+
+	type message struct {
+		Name string
+		File *os.File
+	}
+
+	var (
+		options = Options{
+			WithObjects: NewObjects(message{}),
+		}
+
+		connA, connB = unixConnPair(t)
+
+		socketA = NewSocket(connA, options)
+		socketB = NewSocket(connB, options)
+	)
+
+	defer socketA.Close()
+	defer socketB.Close()
+
+	stray, strayWriter, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stray.Close()
+
+	// A message that does not reference the file sent along with it
+	data, err := Marshal(message{Name: "stray"}, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = writeWithFiles(connA, data, []*os.File{strayWriter})
+	strayWriter.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.CreateTemp(t.TempDir(), "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if _, err = file.WriteString("Hello, World!"); err != nil {
+		t.Fatal(err)
+	}
+
+	err = socketA.WriteTimeout(message{Name: "file", File: file}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj, err := socketB.ReadTimeout(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg, ok := obj.(*message); !ok || msg.Name != "stray" || msg.File != nil {
+		t.Errorf("expected to receive the stray message without a file, got %+v", obj)
+	}
+
+	// The stray descriptor is closed once its message is decoded, leaving no
+	// writer on the pipe
+	stray.SetReadDeadline(time.Now().Add(time.Second))
+
+	if _, err = stray.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("expected the unreferenced file to be closed, got %v", err)
+	}
+
+	obj, err = socketB.ReadTimeout(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, ok := obj.(*message)
+	if !ok || msg.Name != "file" || msg.File == nil {
+		t.Fatalf("expected to receive the file message, got %+v", obj)
+	}
+	defer msg.File.Close()
+
+	content, err := io.ReadAll(io.NewSectionReader(msg.File, 0, 1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(content) != "Hello, World!" {
+		t.Errorf("expected received file to contain \"Hello, World!\", got %q", content)
+	}
+}
+
+func TestSocketPassFilesUnsupported(t *testing.T) {
+
+	t.Parallel()
+
+	type message struct {
+		File *os.File
+	}
+
+	var (
+		options = Options{
+			WithObjects: NewObjects(message{}),
+		}
+
+		socketA, _ = NewPipe(options)
+	)
+
+	err := socketA.Write(message{File: os.Stdin})
+	if _, ok := err.(*ErrFilesUnsupported); !ok {
+		t.Errorf("expected socket.Write() to return *ErrFilesUnsupported, got %v", err)
+	}
+
+	err = socketA.Write(message{File: nil})
+	if err != nil {
+		t.Errorf("expected socket.Write() to accept nil files, got %v", err)
+	}
+}
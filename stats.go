@@ -0,0 +1,126 @@
+package pack
+
+import (
+	"sync"
+	"time"
+)
+
+// Direction of a message recorded by a StatsCollector
+type Direction int
+
+const (
+	DirectionRead Direction = iota
+	DirectionWrite
+)
+
+func (d Direction) String() string {
+	switch d {
+	case DirectionRead:
+		return "read"
+	case DirectionWrite:
+		return "write"
+	}
+
+	return "unknown"
+}
+
+type TypeStats struct {
+	// Amount of messages
+	Count uint64
+
+	// Total size of the messages in bytes
+	Bytes uint64
+
+	// Total time spent encoding or decoding the messages, time spent waiting
+	// for a message to arrive or be sent is not counted
+	Duration time.Duration
+}
+
+type StatsSnapshot struct {
+	// Statistics of messages read, by Object ID
+	Read map[uint]TypeStats
+
+	// Statistics of messages written, by Object ID
+	Write map[uint]TypeStats
+}
+
+type StatsCollector interface {
+	// Record a message of given Object ID
+	Record(dir Direction, id uint, bytes uint64, duration time.Duration)
+
+	// Get a copy of the current statistics
+	Snapshot() StatsSnapshot
+
+	// Reset all statistics to 0
+	Reset()
+}
+
+type statsCollector struct {
+	mu    sync.Mutex
+	read  map[uint]TypeStats
+	write map[uint]TypeStats
+
+	hooks []func(dir Direction, id uint, bytes uint64, duration time.Duration)
+}
+
+// Create a StatsCollector that keeps per message type statistics of Sockets
+// using it through Options.WithStats
+//
+// Hooks are called synchronously for every message recorded, and may be used
+// to export the numbers to metrics systems
+func NewStatsCollector(hooks ...func(dir Direction, id uint, bytes uint64, duration time.Duration)) StatsCollector {
+	return &statsCollector{
+		read:  map[uint]TypeStats{},
+		write: map[uint]TypeStats{},
+		hooks: hooks,
+	}
+}
+
+func (c *statsCollector) Record(dir Direction, id uint, bytes uint64, duration time.Duration) {
+	c.mu.Lock()
+
+	stats := c.read
+	if dir == DirectionWrite {
+		stats = c.write
+	}
+
+	cur := stats[id]
+	cur.Count++
+	cur.Bytes += bytes
+	cur.Duration += duration
+	stats[id] = cur
+
+	c.mu.Unlock()
+
+	for _, hook := range c.hooks {
+		hook(dir, id, bytes, duration)
+	}
+}
+
+func (c *statsCollector) Snapshot() StatsSnapshot {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	snapshot := StatsSnapshot{
+		Read:  make(map[uint]TypeStats, len(c.read)),
+		Write: make(map[uint]TypeStats, len(c.write)),
+	}
+
+	for id, stats := range c.read {
+		snapshot.Read[id] = stats
+	}
+
+	for id, stats := range c.write {
+		snapshot.Write[id] = stats
+	}
+
+	return snapshot
+}
+
+func (c *statsCollector) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.read = map[uint]TypeStats{}
+	c.write = map[uint]TypeStats{}
+}
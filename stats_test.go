@@ -0,0 +1,124 @@
+package pack
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestStatsCollector(t *testing.T) {
+
+	t.Parallel()
+
+	type objectA struct {
+		String string
+	}
+
+	type objectB struct {
+		Value int
+	}
+
+	var (
+		hooked int
+
+		stats = NewStatsCollector(func(dir Direction, id uint, bytes uint64, duration time.Duration) {
+			hooked++
+		})
+
+		options = Options{
+			WithObjects: NewObjects(objectA{}, objectB{}),
+			WithStats:   stats,
+		}
+
+		socketA, socketB = NewPipe(options)
+	)
+
+	inputs := []any{
+		objectA{String: "Hello"},
+		objectA{String: "World"},
+		&objectB{Value: 123},
+	}
+
+	for _, input := range inputs {
+		if err := socketA.Write(input); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := socketB.Read(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	snapshot := stats.Snapshot()
+
+	for _, dir := range []map[uint]TypeStats{snapshot.Read, snapshot.Write} {
+		if dir[1].Count != 2 || dir[2].Count != 1 {
+			t.Errorf("expected 2 messages of ID 1 and 1 message of ID 2, got %+v", dir)
+		}
+	}
+
+	if snapshot.Write[1].Bytes+snapshot.Write[2].Bytes != socketA.BytesWritten() {
+		t.Errorf("expected bytes written by type to add up to %d, got %+v", socketA.BytesWritten(), snapshot.Write)
+	}
+
+	if snapshot.Read[1].Bytes+snapshot.Read[2].Bytes != socketB.BytesRead() {
+		t.Errorf("expected bytes read by type to add up to %d, got %+v", socketB.BytesRead(), snapshot.Read)
+	}
+
+	if hooked != 6 {
+		t.Errorf("expected hook to be called 6 times, got %d", hooked)
+	}
+
+	stats.Reset()
+
+	if snapshot := stats.Snapshot(); len(snapshot.Read) != 0 || len(snapshot.Write) != 0 {
+		t.Errorf("expected statistics to be empty after Reset, got %+v", snapshot)
+	}
+}
+
+func TestStatsReadDuration(t *testing.T) {
+
+	t.Parallel()
+
+	type object struct {
+		String string
+	}
+
+	var (
+		stats = NewStatsCollector()
+
+		options = Options{
+			WithObjects: NewObjects(object{}),
+			WithStats:   stats,
+		}
+
+		connA, connB = net.Pipe()
+
+		socket = NewSocket(connB, options)
+	)
+
+	defer connA.Close()
+	defer socket.Close()
+
+	data, err := Marshal(object{String: "Hello, World!"}, Options{WithObjects: options.WithObjects})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const delay = 100 * time.Millisecond
+
+	// The message arrives in two halves, with a pause in between
+	go func() {
+		connA.Write(data[:len(data)/2])
+		time.Sleep(delay)
+		connA.Write(data[len(data)/2:])
+	}()
+
+	if _, err := socket.ReadTimeout(time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if duration := stats.Snapshot().Read[1].Duration; duration >= delay/2 {
+		t.Errorf("expected time waiting for the message not to be counted as decoding, got %s", duration)
+	}
+}
@@ -0,0 +1,158 @@
+package pack
+
+import (
+	"io"
+	"reflect"
+)
+
+// Maximum amount of data written in a single chunk by EncodeStream
+const streamChunkSize = 32 * 1024
+
+var typeReader = reflect.TypeOf((*io.Reader)(nil)).Elem()
+
+// Write all data from reader as a sequence of length-prefixed chunks,
+// terminated by an empty chunk, without buffering all of it in memory
+func (p *packer) EncodeStream(reader io.Reader, max uint64) error {
+	p.startLimit()
+
+	var (
+		buf   = make([]byte, streamChunkSize)
+		total uint64
+	)
+
+	for {
+		ln, err := io.ReadFull(reader, buf)
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+
+		if ln > 0 {
+			total += uint64(ln)
+
+			if max > 0 && total > max {
+				return &ErrDataTooLarge{typ: typeReader, max: max, size: total}
+			}
+
+			if p.stopat > 0 && p.written+uint64(ln) > p.stopat {
+				return &ErrDataTooLarge{max: p.sizelimit, size: p.written + uint64(ln)}
+			}
+
+			n, werr := WriteVarUint(p.writer, uint64(ln), p.buffer[:])
+			p.written += uint64(n)
+			if werr != nil {
+				return werr
+			}
+
+			n, werr = p.writer.Write(buf[:ln])
+			p.written += uint64(n)
+			if werr != nil {
+				return werr
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	n, err := WriteVarUint(p.writer, 0, p.buffer[:])
+	p.written += uint64(n)
+
+	return err
+}
+
+// Get a reader over a stream written by EncodeStream, chunks are only read
+// from the underlying stream as the returned reader is read from
+func (u *unpacker) DecodeStream(max uint64) io.ReadCloser {
+	u.startLimit()
+
+	return &streamReader{u: u, max: max}
+}
+
+type streamReader struct {
+	u *unpacker
+
+	max   uint64
+	total uint64
+
+	// Bytes left in the current chunk
+	left uint64
+
+	err error
+}
+
+func (s *streamReader) Read(b []byte) (int, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	if s.left == 0 {
+		var ln uint64
+
+		n, err := ReadVarUint(s.u.reader, &ln, s.u.buffer[:])
+		s.u.read += uint64(n)
+		if err != nil {
+			return 0, s.fail(err)
+		}
+
+		if ln == 0 {
+			s.err = io.EOF
+			return 0, io.EOF
+		}
+
+		s.total += ln
+
+		if s.max > 0 && s.total > s.max {
+			return 0, s.fail(&ErrDataTooLarge{typ: typeReader, max: s.max, size: s.total})
+		}
+
+		if s.u.stopat > 0 && s.u.read+ln > s.u.stopat {
+			return 0, s.fail(&ErrDataTooLarge{max: s.u.sizelimit, size: s.u.read + ln - (s.u.stopat - s.u.sizelimit)})
+		}
+
+		s.left = ln
+	}
+
+	if uint64(len(b)) > s.left {
+		b = b[:s.left]
+	}
+
+	n, err := s.u.reader.Read(b)
+	s.u.read += uint64(n)
+	s.left -= uint64(n)
+
+	if err == io.EOF && s.left > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+
+	if err != nil && err != io.EOF {
+		return n, s.fail(err)
+	}
+
+	return n, nil
+}
+
+func (s *streamReader) fail(err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+
+	s.err = err
+
+	return err
+}
+
+// Discard the rest of the stream, so the Unpacker may be used again
+func (s *streamReader) Close() error {
+	_, err := io.Copy(io.Discard, s)
+
+	return err
+}
@@ -0,0 +1,145 @@
+package pack
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestStream(t *testing.T) {
+
+	t.Parallel()
+
+	var (
+		data = bytes.Repeat([]byte("0123456789abcdef"), streamChunkSize/4)
+
+		buf = bytes.NewBuffer(nil)
+
+		packer   = NewPacker(buf)
+		unpacker = NewUnpacker(buf)
+	)
+
+	err := packer.EncodeStream(bytes.NewReader(data), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = packer.Encode("after")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stream := unpacker.DecodeStream(0)
+
+	decoded, err := io.ReadAll(stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(decoded, data) {
+		t.Errorf("expected decoded stream to equal data, got %d bytes", len(decoded))
+	}
+
+	var after string
+
+	err = unpacker.Decode(&after)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if after != "after" {
+		t.Errorf("expected object after stream to decode as \"after\", got %q", after)
+	}
+
+	if packer.BytesWritten() != unpacker.BytesRead() {
+		t.Errorf("expected bytes written to equal bytes read, written: %d / read: %d",
+			packer.BytesWritten(), unpacker.BytesRead())
+	}
+}
+
+func TestStreamClose(t *testing.T) {
+
+	t.Parallel()
+
+	var (
+		buf = bytes.NewBuffer(nil)
+
+		packer   = NewPacker(buf)
+		unpacker = NewUnpacker(buf)
+	)
+
+	packer.EncodeStream(bytes.NewReader(make([]byte, streamChunkSize*3)), 0)
+	packer.Encode(uint(42))
+
+	stream := unpacker.DecodeStream(0)
+
+	_, err := stream.Read(make([]byte, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = stream.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var after uint
+
+	err = unpacker.Decode(&after)
+	if err != nil || after != 42 {
+		t.Errorf("expected object after closed stream to decode as 42, got %d, %v", after, err)
+	}
+}
+
+func TestStreamLimits(t *testing.T) {
+
+	t.Parallel()
+
+	var (
+		data = make([]byte, streamChunkSize*4)
+
+		dataTooLarge *ErrDataTooLarge
+	)
+
+	err := NewPacker(io.Discard).EncodeStream(bytes.NewReader(data), streamChunkSize)
+	if !errors.As(err, &dataTooLarge) {
+		t.Errorf("expected EncodeStream over max to return ErrDataTooLarge, got %v", err)
+	}
+
+	err = NewPacker(io.Discard, Options{SizeLimit: streamChunkSize}).EncodeStream(bytes.NewReader(data), 0)
+	if !errors.As(err, &dataTooLarge) {
+		t.Errorf("expected EncodeStream over SizeLimit to return ErrDataTooLarge, got %v", err)
+	}
+
+	var buf = bytes.NewBuffer(nil)
+
+	err = NewPacker(buf).EncodeStream(bytes.NewReader(data), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encoded := buf.Bytes()
+
+	for _, unpacker := range []struct {
+		name   string
+		stream io.Reader
+	}{
+		{"max", NewUnpacker(bytes.NewReader(encoded)).DecodeStream(streamChunkSize * 2)},
+		{"SizeLimit", NewUnpacker(bytes.NewReader(encoded), Options{SizeLimit: streamChunkSize * 2}).DecodeStream(0)},
+	} {
+		n, err := io.Copy(io.Discard, unpacker.stream)
+		if !errors.As(err, &dataTooLarge) {
+			t.Errorf("%s: expected reading stream over limit to return ErrDataTooLarge, got %v", unpacker.name, err)
+		}
+
+		if n > streamChunkSize*2 {
+			t.Errorf("%s: expected reading to stop before passing the limit, read %d bytes", unpacker.name, n)
+		}
+	}
+
+	_, err = io.ReadAll(NewUnpacker(bytes.NewReader(encoded[:len(encoded)-10])).DecodeStream(0))
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("expected truncated stream to return io.ErrUnexpectedEOF, got %v", err)
+	}
+}
@@ -0,0 +1,184 @@
+package pack
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Maximum time PeerInfo waits for an accepted client to complete the TLS
+// handshake
+const tlsHandshakeTimeout = 10 * time.Second
+
+type PeerInfo struct {
+	// Address of the other side of the connection, nil if unknown
+	RemoteAddr net.Addr
+
+	// State of the TLS connection, nil if the Socket is not over TLS or the
+	// handshake failed
+	TLS *tls.ConnectionState
+}
+
+// Get the certificate the peer identified itself with, nil if the Socket is
+// not over TLS or the peer did not send a certificate
+func (p PeerInfo) Certificate() *x509.Certificate {
+	if p.TLS == nil || len(p.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+
+	return p.TLS.PeerCertificates[0]
+}
+
+type Listener interface {
+	// Wait for the next connection and get a Socket over it
+	Accept() (Socket, error)
+
+	// Stop listening
+	Close() error
+
+	// Get the address being listened on
+	Addr() net.Addr
+}
+
+type listener struct {
+	net.Listener
+
+	options Options
+}
+
+// Create a Listener that accepts Sockets from given net.Listener
+func NewListener(l net.Listener, options Options) Listener {
+	return &listener{Listener: l, options: options}
+}
+
+// TLS handshakes are not run by Accept, so a slow client does not hold back
+// the others, they complete on the Socket's first Read, Write or PeerInfo
+func (l *listener) Accept() (Socket, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSocket(conn, l.options), nil
+}
+
+// Connect to addr over TLS and get a Socket over the connection
+func DialTLS(network, addr string, config *tls.Config, options Options) (Socket, error) {
+	conn, err := tls.Dial(network, addr, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSocket(conn, options), nil
+}
+
+// Listen on addr for TLS connections
+//
+// Set config.ClientAuth to tls.RequireAndVerifyClientCert and config.ClientCAs
+// to verify client certificates, which are then available through the
+// accepted Socket's PeerInfo
+func ListenTLS(network, addr string, config *tls.Config, options Options) (Listener, error) {
+	l, err := tls.Listen(network, addr, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewListener(l, options), nil
+}
+
+// Keeps a certificate loaded from files, reloading it whenever the files
+// change, so long running servers can rotate certificates without restarting
+//
+// Set its GetCertificate method as tls.Config.GetCertificate on servers, or
+// its GetClientCertificate method as tls.Config.GetClientCertificate on clients
+type CertReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// Load certificate and key from given PEM files
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Get the latest modification time of the certificate and key files
+func (r *CertReloader) lastModified() (time.Time, error) {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if keyInfo.ModTime().After(certInfo.ModTime()) {
+		return keyInfo.ModTime(), nil
+	}
+
+	return certInfo.ModTime(), nil
+}
+
+// Load the certificate from its files again, the previous certificate is
+// kept if loading fails
+func (r *CertReloader) Reload() error {
+	modTime, err := r.lastModified()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cert = &cert
+	r.modTime = modTime
+
+	return nil
+}
+
+// Get the current certificate, reloading it first if its files changed
+func (r *CertReloader) Certificate() *tls.Certificate {
+	r.mu.RLock()
+	cert, loaded := r.cert, r.modTime
+	r.mu.RUnlock()
+
+	if modTime, err := r.lastModified(); err == nil && modTime.After(loaded) {
+		if r.Reload() == nil {
+			r.mu.RLock()
+			cert = r.cert
+			r.mu.RUnlock()
+		}
+	}
+
+	return cert
+}
+
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.Certificate(), nil
+}
+
+func (r *CertReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.Certificate(), nil
+}
@@ -0,0 +1,277 @@
+package pack
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func (c *testCert) tls() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key, Leaf: c.cert}
+}
+
+// Generate a certificate signed by parent, or a self-signed CA if parent is nil
+func generateCert(t *testing.T, name string, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	var (
+		signerCert = template
+		signerKey  = key
+	)
+
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signerCert = parent.cert
+		signerKey = parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signerCert, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+func TestTLS(t *testing.T) {
+
+	t.Parallel()
+
+	type object struct {
+		String string
+	}
+
+	var (
+		options = Options{
+			WithObjects: NewObjects(object{}),
+		}
+
+		ca     = generateCert(t, "ca", nil)
+		server = generateCert(t, "server", ca)
+		client = generateCert(t, "client", ca)
+
+		pool = x509.NewCertPool()
+	)
+
+	pool.AddCert(ca.cert)
+
+	listener, err := ListenTLS("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{server.tls()},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	}, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	done := make(chan error, 1)
+
+	go func() {
+		socketServer, err := listener.Accept()
+		if err != nil {
+			done <- err
+			return
+		}
+		defer socketServer.Close()
+
+		if cert := socketServer.PeerInfo().Certificate(); cert == nil || cert.Subject.CommonName != "client" {
+			t.Errorf("expected server to see client certificate with CommonName \"client\", got %+v", cert)
+		}
+
+		obj, err := socketServer.ReadTimeout(time.Second)
+		if err != nil {
+			done <- err
+			return
+		}
+
+		done <- socketServer.WriteTimeout(obj, time.Second)
+	}()
+
+	socketClient, err := DialTLS("tcp", listener.Addr().String(), &tls.Config{
+		Certificates: []tls.Certificate{client.tls()},
+		RootCAs:      pool,
+	}, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer socketClient.Close()
+
+	if cert := socketClient.PeerInfo().Certificate(); cert == nil || cert.Subject.CommonName != "server" {
+		t.Errorf("expected client to see server certificate with CommonName \"server\", got %+v", cert)
+	}
+
+	err = socketClient.WriteTimeout(object{String: "Hello, World!"}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj, err := socketClient.ReadTimeout(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if o, ok := obj.(*object); !ok || o.String != "Hello, World!" {
+		t.Errorf("expected to receive *object with String \"Hello, World!\", got %+v", obj)
+	}
+
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTLSAcceptSlowClient(t *testing.T) {
+
+	t.Parallel()
+
+	type object struct{}
+
+	var (
+		options = Options{
+			WithObjects: NewObjects(object{}),
+		}
+
+		ca     = generateCert(t, "ca", nil)
+		server = generateCert(t, "server", ca)
+
+		pool = x509.NewCertPool()
+	)
+
+	pool.AddCert(ca.cert)
+
+	listener, err := ListenTLS("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{server.tls()},
+	}, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go func() {
+		for {
+			socket, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				socket.PeerInfo()
+				socket.Close()
+			}()
+		}
+	}()
+
+	// A client that never starts the handshake, queued first
+	silent, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+
+	start := time.Now()
+
+	socketClient, err := DialTLS("tcp", listener.Addr().String(), &tls.Config{RootCAs: pool}, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer socketClient.Close()
+
+	if elapsed := time.Since(start); elapsed > tlsHandshakeTimeout/2 {
+		t.Errorf("expected a silent client not to hold back other handshakes, took %s", elapsed)
+	}
+}
+
+func writeCertFiles(t *testing.T, cert *testCert, certFile, keyFile string, modTime time.Time) {
+	keyDer, err := x509.MarshalECPrivateKey(cert.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.der}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range []string{certFile, keyFile} {
+		if err := os.Chtimes(file, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+
+	t.Parallel()
+
+	var (
+		dir = t.TempDir()
+
+		certFile = filepath.Join(dir, "cert.pem")
+		keyFile  = filepath.Join(dir, "key.pem")
+
+		first  = generateCert(t, "first", nil)
+		second = generateCert(t, "second", nil)
+
+		now = time.Now()
+	)
+
+	writeCertFiles(t, first, certFile, keyFile, now.Add(-time.Minute))
+
+	reloader, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, _ := reloader.GetCertificate(nil)
+	if leaf, _ := x509.ParseCertificate(cert.Certificate[0]); leaf.Subject.CommonName != "first" {
+		t.Errorf("expected certificate \"first\" to be loaded, got %q", leaf.Subject.CommonName)
+	}
+
+	writeCertFiles(t, second, certFile, keyFile, now)
+
+	cert, _ = reloader.GetCertificate(nil)
+	if leaf, _ := x509.ParseCertificate(cert.Certificate[0]); leaf.Subject.CommonName != "second" {
+		t.Errorf("expected certificate \"second\" to be reloaded, got %q", leaf.Subject.CommonName)
+	}
+}
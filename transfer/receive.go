@@ -0,0 +1,202 @@
+package transfer
+
+import (
+	"crypto/sha256"
+	"hash/crc32"
+	"io"
+	"sync"
+
+	"github.com/NublyBR/go-pack"
+)
+
+// Where a received payload is written to, it's read back to check the hash
+// of the payload, which includes data written before a transfer was resumed
+type Destination interface {
+	io.WriterAt
+	io.ReaderAt
+}
+
+type ReceiveOptions struct {
+	// Function called with every Offer to get where to write the payload,
+	// returning an error rejects the transfer, may not be nil
+	//
+	// Resumed transfers are given the same Destination again, which must
+	// still hold the data written before
+	Open func(offer Offer) (Destination, error)
+
+	// Optional function called whenever data is acknowledged, starting with
+	// the offset the transfer resumed from
+	Progress func(offer Offer, received uint64)
+}
+
+// Receives transfers, remembering how much of each interrupted transfer was
+// acknowledged so that it resumes from there when retried, over the same or
+// another Socket
+type Receiver struct {
+	options ReceiveOptions
+
+	mu      sync.Mutex
+	partial map[Offer]uint64
+}
+
+func NewReceiver(options ReceiveOptions) *Receiver {
+	if options.Open == nil {
+		panic("Open may not be nil in ReceiveOptions")
+	}
+
+	return &Receiver{
+		options: options,
+		partial: map[Offer]uint64{},
+	}
+}
+
+// Get the offset a transfer of offer resumes from
+func (r *Receiver) Offset(offer Offer) uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.partial[offer]
+}
+
+func (r *Receiver) save(offer Offer, offset uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.partial[offer] = offset
+}
+
+func (r *Receiver) forget(offer Offer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.partial, offer)
+}
+
+// Receive a single transfer over socket, returning its Offer once the whole
+// payload was written and its hash checked
+func (r *Receiver) Receive(socket pack.Socket) (Offer, error) {
+	msg, err := socket.Read()
+	if err != nil {
+		return Offer{}, err
+	}
+
+	offerMsg, ok := msg.(*Offer)
+	if !ok {
+		return Offer{}, ErrUnexpectedMessage
+	}
+
+	offer := *offerMsg
+
+	if offer.ChunkSize == 0 {
+		socket.Write(&complete{Error: ErrUnexpectedMessage.Error()})
+		return offer, ErrUnexpectedMessage
+	}
+
+	dest, err := r.options.Open(offer)
+	if err != nil {
+		socket.Write(&complete{Error: err.Error()})
+		return offer, err
+	}
+
+	offset := r.Offset(offer)
+
+	err = socket.Write(&resume{Offset: offset})
+	if err != nil {
+		return offer, err
+	}
+
+	r.progress(offer, offset)
+
+	for {
+		msg, err := socket.Read()
+		if err != nil {
+			return offer, err
+		}
+
+		switch msg := msg.(type) {
+		case *chunk:
+			// Chunks sent before asking to resume from an earlier offset
+			if msg.Index*offer.ChunkSize != offset {
+				continue
+			}
+
+			var ln = uint64(len(msg.Data))
+
+			if ln == 0 || ln > offer.ChunkSize || offset+ln > offer.Size || crc32.ChecksumIEEE(msg.Data) != msg.CRC {
+				err = socket.Write(&resume{Offset: offset})
+				if err != nil {
+					return offer, err
+				}
+
+				continue
+			}
+
+			_, err = dest.WriteAt(msg.Data, int64(offset))
+			if err != nil {
+				socket.Write(&complete{Error: err.Error()})
+				return offer, err
+			}
+
+			offset += ln
+			r.save(offer, offset)
+
+			err = socket.Write(&ack{Offset: offset})
+			if err != nil {
+				return offer, err
+			}
+
+			r.progress(offer, offset)
+
+		case *done:
+			err := r.check(dest, offer, offset, msg.Hash)
+			if err == ErrHashMismatch {
+				r.forget(offer)
+			}
+
+			if err != nil {
+				socket.Write(&complete{Error: err.Error()})
+				return offer, err
+			}
+
+			r.forget(offer)
+
+			return offer, socket.Write(&complete{})
+
+		case *cancel:
+			socket.Write(&complete{})
+			return offer, ErrCanceled
+
+		default:
+			socket.Write(&complete{Error: ErrUnexpectedMessage.Error()})
+			return offer, ErrUnexpectedMessage
+		}
+	}
+}
+
+func (r *Receiver) progress(offer Offer, received uint64) {
+	if r.options.Progress != nil {
+		r.options.Progress(offer, received)
+	}
+}
+
+func (r *Receiver) check(dest Destination, offer Offer, offset uint64, expected [32]byte) error {
+	if offset != offer.Size {
+		return ErrUnexpectedMessage
+	}
+
+	var (
+		hash = sha256.New()
+		sum  [32]byte
+	)
+
+	_, err := io.Copy(hash, io.NewSectionReader(dest, 0, int64(offer.Size)))
+	if err != nil {
+		return err
+	}
+
+	if hash.Sum(sum[:0]); sum != expected {
+		return ErrHashMismatch
+	}
+
+	return nil
+}
@@ -0,0 +1,263 @@
+package transfer
+
+import (
+	"crypto/sha256"
+	"hash/crc32"
+	"io"
+
+	"github.com/NublyBR/go-pack"
+)
+
+type SendOptions struct {
+	// Identifies the payload so interrupted transfers can be resumed
+	ID string
+
+	// Size of each chunk in bytes (default: 64 KiB)
+	ChunkSize int
+
+	// Maximum amount of chunks sent ahead of the last acknowledged one
+	// (default: 8)
+	Window int
+
+	// Optional function called whenever the receiver acknowledges data,
+	// starting with the offset the transfer resumed from
+	Progress func(acked, total uint64)
+}
+
+// Send size bytes of payload over socket to a Receiver
+func Send(socket pack.Socket, payload io.ReaderAt, size uint64, options SendOptions) error {
+	if options.ChunkSize <= 0 {
+		options.ChunkSize = 64 * 1024
+	}
+
+	if options.Window <= 0 {
+		options.Window = 8
+	}
+
+	var chunkSize = uint64(options.ChunkSize)
+
+	err := socket.Write(&Offer{ID: options.ID, Size: size, ChunkSize: chunkSize})
+	if err != nil {
+		return err
+	}
+
+	msg, err := socket.Read()
+	if err != nil {
+		return err
+	}
+
+	var acked uint64
+
+	switch msg := msg.(type) {
+	case *resume:
+		acked = msg.Offset
+
+	case *complete:
+		return &ErrRemote{message: msg.Error}
+
+	default:
+		return ErrUnexpectedMessage
+	}
+
+	// Transfers interrupted after the last chunk was acknowledged resume
+	// from the end of the payload, which may not be a multiple of chunkSize
+	if acked > size || (acked%chunkSize != 0 && acked != size) {
+		// Let the receiver stop waiting for chunks
+		if err := socket.Write(&cancel{Error: ErrUnexpectedMessage.Error()}); err == nil {
+			socket.Read()
+		}
+
+		return ErrUnexpectedMessage
+	}
+
+	s := &sender{
+		socket:  socket,
+		payload: payload,
+		size:    size,
+		options: options,
+		replies: make(chan any, options.Window+1),
+		stop:    make(chan struct{}),
+		buffer:  make([]byte, chunkSize),
+	}
+
+	go s.readLoop()
+
+	return s.run(acked)
+}
+
+type sender struct {
+	socket  pack.Socket
+	payload io.ReaderAt
+	size    uint64
+	options SendOptions
+
+	// Messages from the receiver, or the error that stopped reading them
+	replies chan any
+
+	// Closed once run returns, so readLoop never waits on replies after it
+	stop chan struct{}
+
+	buffer []byte
+}
+
+// Read replies until the transfer completes, so nothing else is read
+// from the Socket afterwards
+func (s *sender) readLoop() {
+	for {
+		msg, err := s.socket.Read()
+		if err != nil {
+			select {
+			case s.replies <- err:
+			case <-s.stop:
+			}
+
+			return
+		}
+
+		select {
+		case s.replies <- msg:
+		case <-s.stop:
+			return
+		}
+
+		if _, ok := msg.(*complete); ok {
+			return
+		}
+	}
+}
+
+func (s *sender) progress(acked uint64) {
+	if s.options.Progress != nil {
+		s.options.Progress(acked, s.size)
+	}
+}
+
+func (s *sender) run(acked uint64) error {
+	var (
+		chunkSize = uint64(len(s.buffer))
+		window    = chunkSize * uint64(s.options.Window)
+		next      = acked
+		finished  bool
+	)
+
+	defer close(s.stop)
+
+	s.progress(acked)
+
+	for {
+		for next < s.size && next-acked < window {
+			n, err := s.sendChunk(next)
+			if err != nil {
+				return s.abort(err)
+			}
+
+			next += n
+		}
+
+		if acked == s.size && !finished {
+			hash, err := s.hash()
+			if err != nil {
+				return s.abort(err)
+			}
+
+			err = s.socket.Write(&done{Hash: hash})
+			if err != nil {
+				return s.abort(err)
+			}
+
+			finished = true
+		}
+
+		switch msg := (<-s.replies).(type) {
+		case *ack:
+			if msg.Offset > acked && msg.Offset <= next {
+				acked = msg.Offset
+				s.progress(acked)
+			}
+
+		case *resume:
+			// A chunk was corrupted, send everything after it again
+			if (msg.Offset%chunkSize != 0 && msg.Offset != s.size) || msg.Offset > s.size {
+				return s.abort(ErrUnexpectedMessage)
+			}
+
+			acked, next = msg.Offset, msg.Offset
+
+		case *complete:
+			if msg.Error != "" {
+				return &ErrRemote{message: msg.Error}
+			}
+
+			if !finished {
+				// The receiver already stopped, so there is nothing to cancel
+				return ErrUnexpectedMessage
+			}
+
+			return nil
+
+		case error:
+			return msg
+
+		default:
+			return s.abort(ErrUnexpectedMessage)
+		}
+	}
+}
+
+func (s *sender) sendChunk(offset uint64) (uint64, error) {
+	var data = s.buffer
+
+	if s.size-offset < uint64(len(data)) {
+		data = data[:s.size-offset]
+	}
+
+	n, err := s.payload.ReadAt(data, int64(offset))
+	if n < len(data) {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+
+		return 0, err
+	}
+
+	err = s.socket.Write(&chunk{
+		Index: offset / uint64(len(s.buffer)),
+		CRC:   crc32.ChecksumIEEE(data),
+		Data:  data,
+	})
+
+	return uint64(len(data)), err
+}
+
+func (s *sender) hash() ([32]byte, error) {
+	var (
+		hash = sha256.New()
+		sum  [32]byte
+	)
+
+	_, err := io.Copy(hash, io.NewSectionReader(s.payload, 0, int64(s.size)))
+	if err != nil {
+		return sum, err
+	}
+
+	hash.Sum(sum[:0])
+
+	return sum, nil
+}
+
+// Tell the receiver the transfer is canceled and wait for it to complete,
+// which also stops readLoop
+func (s *sender) abort(cause error) error {
+	if err := s.socket.Write(&cancel{Error: cause.Error()}); err != nil {
+		return cause
+	}
+
+	for reply := range s.replies {
+		switch reply.(type) {
+		case *complete, error:
+			return cause
+		}
+	}
+
+	return cause
+}
@@ -0,0 +1,96 @@
+// Package transfer implements resumable transfers of large payloads over
+// pack Sockets.
+//
+// The payload is split into numbered chunks, each with its own checksum, and
+// the receiver acknowledges every chunk written, so that a transfer cut short
+// by a lost connection resumes from the last acknowledged offset once it's
+// retried. A hash of the whole payload is checked once every chunk arrived.
+//
+// Sockets used for transfers must be created with Objects that went through
+// Register, and may not be used for anything else while a transfer is running.
+package transfer
+
+import (
+	"errors"
+
+	"github.com/NublyBR/go-pack"
+)
+
+var (
+	// Returned when the other side sent a message that is not part of the
+	// protocol at this point
+	ErrUnexpectedMessage = errors.New("transfer: unexpected message")
+
+	// Returned when the payload received does not match the hash sent by the
+	// sender, the transfer starts over from zero if retried
+	ErrHashMismatch = errors.New("transfer: payload hash mismatch")
+
+	// Returned by Receiver.Receive when the sender gave up on the transfer,
+	// it may be resumed later
+	ErrCanceled = errors.New("transfer: canceled by sender")
+)
+
+// Error reported by the other side of a transfer
+type ErrRemote struct {
+	message string
+}
+
+func (e *ErrRemote) Error() string {
+	return "transfer: remote error: " + e.message
+}
+
+// Add the messages of the transfer protocol to objects, both sides must
+// register them at the same point
+func Register(objects pack.Objects) pack.Objects {
+	return objects.Push(Offer{}, resume{}, chunk{}, ack{}, done{}, cancel{}, complete{})
+}
+
+// Sent by the sender to start a transfer
+type Offer struct {
+	// Identifies the payload, the receiver resumes transfers with the same ID
+	// and Size
+	ID string
+
+	// Size of the payload in bytes
+	Size uint64
+
+	// Size of every chunk but the last
+	ChunkSize uint64
+}
+
+// Sent by the receiver, in reply to the Offer, to set the offset the sender
+// must continue from, and again whenever a chunk fails its checksum
+type resume struct {
+	Offset uint64
+}
+
+type chunk struct {
+	// Chunk number, its data starts at Index * ChunkSize
+	Index uint64
+
+	// CRC-32 (IEEE) of Data
+	CRC uint32
+
+	Data []byte
+}
+
+// Sent by the receiver once every chunk up to Offset was written
+type ack struct {
+	Offset uint64
+}
+
+// Sent by the sender once every chunk was acknowledged
+type done struct {
+	// SHA-256 of the whole payload
+	Hash [32]byte
+}
+
+// Sent by the sender when giving up on the transfer
+type cancel struct {
+	Error string
+}
+
+// Sent by the receiver to end the transfer, with a message if it failed
+type complete struct {
+	Error string
+}
@@ -0,0 +1,396 @@
+package transfer
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NublyBR/go-pack"
+)
+
+// In-memory Destination
+type memory struct {
+	mu   sync.Mutex
+	data []byte
+}
+
+func (m *memory) WriteAt(b []byte, off int64) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if end := int(off) + len(b); end > len(m.data) {
+		m.data = append(m.data, make([]byte, end-len(m.data))...)
+	}
+
+	return copy(m.data[off:], b), nil
+}
+
+func (m *memory) ReadAt(b []byte, off int64) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if off >= int64(len(m.data)) {
+		return 0, io.EOF
+	}
+
+	n := copy(b, m.data[off:])
+	if n < len(b) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+// Payload that fails to be read past a given offset
+type failingReader struct {
+	io.ReaderAt
+	failAt int64
+}
+
+var errFailed = errors.New("failed")
+
+func (f *failingReader) ReadAt(b []byte, off int64) (int, error) {
+	if off+int64(len(b)) > f.failAt {
+		return 0, errFailed
+	}
+
+	return f.ReaderAt.ReadAt(b, off)
+}
+
+// Socket that corrupts the first chunk it writes
+type corruptingSocket struct {
+	pack.Socket
+	once sync.Once
+}
+
+func (s *corruptingSocket) Write(data any) error {
+	if c, ok := data.(*chunk); ok {
+		s.once.Do(func() {
+			corrupted := *c
+			corrupted.Data = append([]byte{}, c.Data...)
+			corrupted.Data[0] ^= 0xff
+			data = &corrupted
+		})
+	}
+
+	return s.Socket.Write(data)
+}
+
+// Socket that drops the connection instead of writing done
+type droppingSocket struct {
+	pack.Socket
+}
+
+func (s *droppingSocket) Write(data any) error {
+	if _, ok := data.(*done); ok {
+		s.Socket.Close()
+		return io.ErrClosedPipe
+	}
+
+	return s.Socket.Write(data)
+}
+
+func payload(size int) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(1)).Read(data)
+	return data
+}
+
+func pipe() (pack.Socket, pack.Socket) {
+	return pack.NewPipe(pack.Options{WithObjects: Register(pack.NewObjects())})
+}
+
+// Run a transfer from sender to a new Socket pair, returning the errors
+// of both sides
+func run(receiver *Receiver, send func(pack.Socket) error) (sendErr, recvErr error) {
+	a, b := pipe()
+	defer a.Close()
+	defer b.Close()
+
+	result := make(chan error, 1)
+
+	go func() {
+		_, err := receiver.Receive(b)
+		result <- err
+	}()
+
+	sendErr = send(a)
+
+	return sendErr, <-result
+}
+
+func TestTransfer(t *testing.T) {
+
+	t.Parallel()
+
+	var (
+		data = payload(100_000)
+		dest = &memory{}
+
+		sent, received []uint64
+
+		receiver = NewReceiver(ReceiveOptions{
+			Open: func(offer Offer) (Destination, error) {
+				if offer.ID != "data" || offer.Size != uint64(len(data)) {
+					t.Errorf("expected offer of %d bytes with ID \"data\", got %+v", len(data), offer)
+				}
+				return dest, nil
+			},
+			Progress: func(offer Offer, n uint64) {
+				received = append(received, n)
+			},
+		})
+	)
+
+	sendErr, recvErr := run(receiver, func(socket pack.Socket) error {
+		return Send(socket, bytes.NewReader(data), uint64(len(data)), SendOptions{
+			ID:        "data",
+			ChunkSize: 4096,
+			Progress: func(acked, total uint64) {
+				sent = append(sent, acked)
+			},
+		})
+	})
+
+	if sendErr != nil || recvErr != nil {
+		t.Fatalf("expected transfer to succeed, got sender: %v / receiver: %v", sendErr, recvErr)
+	}
+
+	if !bytes.Equal(dest.data, data) {
+		t.Errorf("expected received data to equal payload")
+	}
+
+	for _, progress := range [][]uint64{sent, received} {
+		if len(progress) != 26 || progress[0] != 0 || progress[len(progress)-1] != uint64(len(data)) {
+			t.Errorf("expected progress from 0 to %d in 26 calls, got %v", len(data), progress)
+		}
+	}
+}
+
+func TestTransferResume(t *testing.T) {
+
+	t.Parallel()
+
+	var (
+		data = payload(100_000)
+		dest = &memory{}
+
+		receiver = NewReceiver(ReceiveOptions{
+			Open: func(offer Offer) (Destination, error) {
+				return dest, nil
+			},
+		})
+
+		options = SendOptions{ID: "data", ChunkSize: 4096}
+	)
+
+	sendErr, recvErr := run(receiver, func(socket pack.Socket) error {
+		return Send(socket, &failingReader{bytes.NewReader(data), 50_000}, uint64(len(data)), options)
+	})
+
+	if sendErr != errFailed || recvErr != ErrCanceled {
+		t.Fatalf("expected failing transfer to be canceled, got sender: %v / receiver: %v", sendErr, recvErr)
+	}
+
+	offer := Offer{ID: "data", Size: uint64(len(data)), ChunkSize: 4096}
+
+	if offset := receiver.Offset(offer); offset != 49152 {
+		t.Errorf("expected receiver to have acknowledged 49152 bytes, got %d", offset)
+	}
+
+	var resumedFrom = -1
+
+	options.Progress = func(acked, total uint64) {
+		if resumedFrom == -1 {
+			resumedFrom = int(acked)
+		}
+	}
+
+	sendErr, recvErr = run(receiver, func(socket pack.Socket) error {
+		return Send(&corruptingSocket{Socket: socket}, bytes.NewReader(data), uint64(len(data)), options)
+	})
+
+	if sendErr != nil || recvErr != nil {
+		t.Fatalf("expected resumed transfer to succeed, got sender: %v / receiver: %v", sendErr, recvErr)
+	}
+
+	if resumedFrom != 49152 {
+		t.Errorf("expected transfer to resume from 49152, got %d", resumedFrom)
+	}
+
+	if !bytes.Equal(dest.data, data) {
+		t.Errorf("expected received data to equal payload")
+	}
+
+	if offset := receiver.Offset(offer); offset != 0 {
+		t.Errorf("expected completed transfer to be forgotten, got offset %d", offset)
+	}
+}
+
+func TestTransferResumeComplete(t *testing.T) {
+
+	t.Parallel()
+
+	var (
+		data = payload(100_000)
+		dest = &memory{}
+
+		receiver = NewReceiver(ReceiveOptions{
+			Open: func(offer Offer) (Destination, error) {
+				return dest, nil
+			},
+		})
+
+		options = SendOptions{ID: "data", ChunkSize: 4096}
+	)
+
+	sendErr, recvErr := run(receiver, func(socket pack.Socket) error {
+		return Send(&droppingSocket{Socket: socket}, bytes.NewReader(data), uint64(len(data)), options)
+	})
+
+	if sendErr == nil || recvErr == nil {
+		t.Fatalf("expected dropped transfer to fail, got sender: %v / receiver: %v", sendErr, recvErr)
+	}
+
+	offer := Offer{ID: "data", Size: uint64(len(data)), ChunkSize: 4096}
+
+	if offset := receiver.Offset(offer); offset != uint64(len(data)) {
+		t.Errorf("expected receiver to have acknowledged all %d bytes, got %d", len(data), offset)
+	}
+
+	var resumedFrom = -1
+
+	options.Progress = func(acked, total uint64) {
+		if resumedFrom == -1 {
+			resumedFrom = int(acked)
+		}
+	}
+
+	sendErr, recvErr = run(receiver, func(socket pack.Socket) error {
+		return Send(socket, bytes.NewReader(data), uint64(len(data)), options)
+	})
+
+	if sendErr != nil || recvErr != nil {
+		t.Fatalf("expected resumed transfer to succeed, got sender: %v / receiver: %v", sendErr, recvErr)
+	}
+
+	if resumedFrom != len(data) {
+		t.Errorf("expected transfer to resume from %d, got %d", len(data), resumedFrom)
+	}
+
+	if !bytes.Equal(dest.data, data) {
+		t.Errorf("expected received data to equal payload")
+	}
+
+	if offset := receiver.Offset(offer); offset != 0 {
+		t.Errorf("expected completed transfer to be forgotten, got offset %d", offset)
+	}
+}
+
+func TestTransferErrors(t *testing.T) {
+
+	t.Parallel()
+
+	var (
+		data = payload(10_000)
+		dest = &memory{}
+
+		rejected = errors.New("no room")
+
+		receiver = NewReceiver(ReceiveOptions{
+			Open: func(offer Offer) (Destination, error) {
+				if offer.ID == "rejected" {
+					return nil, rejected
+				}
+				return dest, nil
+			},
+		})
+
+		remote *ErrRemote
+	)
+
+	sendErr, recvErr := run(receiver, func(socket pack.Socket) error {
+		return Send(socket, bytes.NewReader(data), uint64(len(data)), SendOptions{ID: "rejected"})
+	})
+
+	if !errors.As(sendErr, &remote) || recvErr != rejected {
+		t.Errorf("expected rejected transfer to fail, got sender: %v / receiver: %v", sendErr, recvErr)
+	}
+
+	// Data in the destination differs from what was acknowledged before
+	receiver.save(Offer{ID: "data", Size: uint64(len(data)), ChunkSize: 1000}, 5000)
+	dest.WriteAt(make([]byte, 5000), 0)
+
+	sendErr, recvErr = run(receiver, func(socket pack.Socket) error {
+		return Send(socket, bytes.NewReader(data), uint64(len(data)), SendOptions{ID: "data", ChunkSize: 1000})
+	})
+
+	if !errors.As(sendErr, &remote) || recvErr != ErrHashMismatch {
+		t.Errorf("expected hash mismatch, got sender: %v / receiver: %v", sendErr, recvErr)
+	}
+
+	sendErr, recvErr = run(receiver, func(socket pack.Socket) error {
+		return Send(socket, bytes.NewReader(data), uint64(len(data)), SendOptions{ID: "data", ChunkSize: 1000})
+	})
+
+	if sendErr != nil || recvErr != nil || !bytes.Equal(dest.data, data) {
+		t.Errorf("expected transfer to start over after hash mismatch, got sender: %v / receiver: %v", sendErr, recvErr)
+	}
+}
+
+func TestTransferInvalidResume(t *testing.T) {
+
+	t.Parallel()
+
+	var (
+		data = payload(10_000)
+
+		a, b = pipe()
+	)
+
+	defer a.Close()
+	defer b.Close()
+
+	// Receiver asking to resume from an offset that is not a chunk boundary,
+	// then sending something else once the transfer is canceled
+	go func() {
+		b.Read()
+		b.Write(&resume{Offset: 0})
+
+		for {
+			msg, err := b.Read()
+			if err != nil {
+				return
+			}
+
+			switch msg.(type) {
+			case *chunk:
+				b.Write(&resume{Offset: 1})
+
+			case *cancel:
+				b.Write(&complete{})
+				b.Write(&ack{Offset: 42})
+				return
+			}
+		}
+	}()
+
+	err := Send(a, bytes.NewReader(data), uint64(len(data)), SendOptions{ChunkSize: 1000})
+	if err != ErrUnexpectedMessage {
+		t.Fatalf("expected invalid resume to return ErrUnexpectedMessage, got %v", err)
+	}
+
+	// Send stops reading once it returns, leaving the rest to the caller
+	msg, err := a.ReadTimeout(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ack, ok := msg.(*ack); !ok || ack.Offset != 42 {
+		t.Errorf("expected the message sent after the transfer to be left unread, got %+v", msg)
+	}
+}
@@ -1,10 +1,11 @@
 package pack
 
 import (
-	"encoding/binary"
+	"fmt"
 	"io"
 	"math"
 	"reflect"
+	"strconv"
 	"unsafe"
 )
 
@@ -28,11 +29,27 @@ type Unpacker interface {
 
 	// Set size limit
 	SetSizeLimit(sizeLimit uint64)
+
+	// Get a reader over a stream encoded with Packer.EncodeStream, max limits
+	// the total size of the data (0 means no limit)
+	//
+	// The stream is read lazily, so it must be read until io.EOF or closed
+	// before decoding anything else, closing it discards the unread data
+	DecodeStream(max uint64) io.ReadCloser
 }
 
 type unpacker struct {
 	realReader io.Reader
 
+	// Files received alongside the data, only set for Sockets that can pass them
+	files *fileTable
+
+	// Input of Unmarshal in zero-copy mode, see Options.ZeroCopy
+	slice *sliceReader
+
+	// Decode into existing values, see Options.Reuse
+	reuse bool
+
 	reader io.Reader
 	read   uint64
 	buffer dataBuffer
@@ -41,6 +58,17 @@ type unpacker struct {
 	subobj    map[string]Objects
 	sizelimit uint64
 	stopat    uint64
+	zigzag    bool
+	intern    bool
+	preserve  bool
+
+	// Strings decoded so far by the current top-level object, indexed by ID,
+	// see Options.Intern
+	interned []string
+
+	// Pointers, maps and slices decoded so far by the current top-level
+	// object, indexed by ID, see Options.PreserveReferences
+	refs []reflect.Value
 }
 
 func NewUnpacker(reader io.Reader, options ...Options) Unpacker {
@@ -56,6 +84,21 @@ func NewUnpacker(reader io.Reader, options ...Options) Unpacker {
 		for key, opt := range opt.WithSubObjects {
 			u.subobj[key] = opt
 		}
+		if opt.ZeroCopy {
+			u.slice, _ = reader.(*sliceReader)
+		}
+		if opt.Reuse {
+			u.reuse = true
+		}
+		if opt.ZigZag {
+			u.zigzag = true
+		}
+		if opt.Intern {
+			u.intern = true
+		}
+		if opt.PreserveReferences || opt.CyclePolicy == CyclePreserve {
+			u.preserve = true
+		}
 	}
 
 	if u.sizelimit <= 0 {
@@ -65,7 +108,8 @@ func NewUnpacker(reader io.Reader, options ...Options) Unpacker {
 	return u
 }
 
-func (u *unpacker) Decode(data any) error {
+// Start enforcing the size limit for a new top-level object
+func (u *unpacker) startLimit() {
 	if u.sizelimit > 0 {
 		u.stopat = u.read + u.sizelimit
 		u.reader = &limitedReader{
@@ -74,6 +118,16 @@ func (u *unpacker) Decode(data any) error {
 			R: u.realReader,
 		}
 	}
+}
+
+func (u *unpacker) Decode(data any) error {
+	u.startLimit()
+
+	clear(u.interned)
+	u.interned = u.interned[:0]
+
+	clear(u.refs)
+	u.refs = u.refs[:0]
 
 	if u.objects != nil {
 		return u.decodeObject(data, u.objects, packerInfo{})
@@ -120,7 +174,22 @@ func (u *unpacker) decodeObject(data any, objects Objects, info packerInfo) erro
 		return &ErrNotDefined{oid: uint(oid)}
 	}
 
-	item := reflect.New(typ)
+	var (
+		cur  = reflect.ValueOf(data).Elem()
+		item reflect.Value
+	)
+
+	// Decode into the object currently held, if it's of the same type
+	if u.reuse && !cur.IsNil() && cur.Elem().Type() == reflect.PointerTo(typ) && !cur.Elem().IsNil() {
+		item = cur.Elem()
+	} else {
+		item = reflect.New(typ)
+	}
+
+	// Registered as the encoder does, so it may be referenced from within it
+	if u.preserve {
+		u.refs = append(u.refs, item)
+	}
 
 	err = u.decode(item.Interface(), info)
 	if err != nil {
@@ -131,7 +200,8 @@ func (u *unpacker) decodeObject(data any, objects Objects, info packerInfo) erro
 	return nil
 }
 
-func (u *unpacker) decodeBytes(ln uint64, info packerInfo) ([]byte, error) {
+// Decode ln bytes, into buf if it has enough capacity
+func (u *unpacker) decodeBytes(ln uint64, info packerInfo, buf []byte) ([]byte, error) {
 	if info.maxSize > 0 && ln > uint64(info.maxSize) {
 		return nil, &ErrDataTooLarge{typ: reflect.TypeOf([]byte{}), max: info.maxSize, size: ln}
 	}
@@ -141,10 +211,18 @@ func (u *unpacker) decodeBytes(ln uint64, info packerInfo) ([]byte, error) {
 	}
 
 	if ln == 0 {
-		return nil, nil
+		return buf[:0], nil
+	}
+
+	if u.slice != nil {
+		return u.nextSlice(ln)
 	}
 
-	var buf = make([]byte, int(ln))
+	if uint64(cap(buf)) >= ln {
+		buf = buf[:ln]
+	} else {
+		buf = make([]byte, int(ln))
+	}
 
 	n, err := io.ReadFull(u.reader, buf)
 	u.read += uint64(n)
@@ -155,7 +233,30 @@ func (u *unpacker) decodeBytes(ln uint64, info packerInfo) ([]byte, error) {
 	return buf, err
 }
 
-func (u *unpacker) decodeBoolSlice(tln uint64, info packerInfo) ([]bool, error) {
+// Get the next ln bytes of the input in zero-copy mode
+func (u *unpacker) nextSlice(ln uint64) ([]byte, error) {
+	// Keep the limit of the top-level object in sync, as if read through it
+	if limited, ok := u.reader.(*limitedReader); ok {
+		if ln > limited.N {
+			limited.N -= ln
+			return nil, &ErrDataTooLarge{max: limited.O, size: limited.O - limited.N}
+		}
+
+		limited.N -= ln
+	}
+
+	buf, err := u.slice.next(ln)
+	if err != nil {
+		return nil, err
+	}
+
+	u.read += ln
+
+	return buf, nil
+}
+
+// Decode tln bools, into buf if it has enough capacity
+func (u *unpacker) decodeBoolSlice(tln uint64, info packerInfo, buf []bool) ([]bool, error) {
 	ln := (tln + 7) / 8
 
 	if info.maxSize > 0 && ln > uint64(info.maxSize) {
@@ -167,10 +268,14 @@ func (u *unpacker) decodeBoolSlice(tln uint64, info packerInfo) ([]bool, error)
 	}
 
 	if ln == 0 {
-		return nil, nil
+		return buf[:0], nil
 	}
 
-	var buf = make([]bool, int(tln))
+	if uint64(cap(buf)) >= tln {
+		buf = buf[:tln]
+	} else {
+		buf = make([]bool, int(tln))
+	}
 
 	for j := 0; j < int(tln); j += 8 {
 		n, err := u.reader.Read(u.buffer[:1])
@@ -319,8 +424,29 @@ func (u *unpacker) decode(data any, info packerInfo) error {
 		val = reflect.ValueOf(data).Elem()
 	)
 
+	if isFileType(typ) {
+		return u.decodeFile(val)
+	}
+
 	switch typ.Kind() {
 	case reflect.Pointer:
+		if u.preserve {
+			done, id, err := u.decodeRef(val)
+			if done || err != nil {
+				return err
+			}
+
+			if !u.reuse || val.IsNil() {
+				val.Set(reflect.New(typ.Elem()))
+			}
+
+			// Registered before its value is decoded, so it may be
+			// referenced from within it
+			u.refs[id] = reflect.ValueOf(val.Interface())
+
+			return u.decode(val.Interface(), info)
+		}
+
 		n, err := u.reader.Read(u.buffer[:1])
 		u.read += uint64(n)
 		if err != nil {
@@ -328,12 +454,17 @@ func (u *unpacker) decode(data any, info packerInfo) error {
 		}
 
 		if u.buffer[0] == 0 {
+			val.SetZero()
 			return nil
 		}
 
+		if u.reuse && !val.IsNil() {
+			return u.decode(val.Interface(), info)
+		}
+
 		item := reflect.New(typ.Elem())
 
-		err = u.decode(item.Interface(), packerInfo{})
+		err = u.decode(item.Interface(), info)
 		if err != nil {
 			return err
 		}
@@ -369,9 +500,30 @@ func (u *unpacker) decode(data any, info packerInfo) error {
 		return nil
 
 	case reflect.Int, reflect.Int16, reflect.Int32, reflect.Int64:
-		var num int64
+		if info.order != nil {
+			size := fixedSize(typ.Kind())
+
+			num, err := u.readFixed(size, info.order)
+			if err != nil {
+				return err
+			}
+
+			val.SetInt(signExtend(num, size))
+
+			return nil
+		}
 
-		n, err := ReadVarInt(u.reader, &num, u.buffer[:])
+		var (
+			num int64
+			n   int
+			err error
+		)
+
+		if info.zigzag || u.zigzag {
+			n, err = ReadZigZag(u.reader, &num, u.buffer[:])
+		} else {
+			n, err = ReadVarInt(u.reader, &num, u.buffer[:])
+		}
 		u.read += uint64(n)
 		if err != nil {
 			return err
@@ -382,6 +534,17 @@ func (u *unpacker) decode(data any, info packerInfo) error {
 		return nil
 
 	case reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if info.order != nil {
+			num, err := u.readFixed(fixedSize(typ.Kind()), info.order)
+			if err != nil {
+				return err
+			}
+
+			val.SetUint(num)
+
+			return nil
+		}
+
 		var num uint64
 
 		n, err := ReadVarUint(u.reader, &num, u.buffer[:])
@@ -395,68 +558,62 @@ func (u *unpacker) decode(data any, info packerInfo) error {
 		return nil
 
 	case reflect.Float32:
-		n, err := io.ReadFull(u.reader, u.buffer[0:4])
-		u.read += uint64(n)
+		num, err := u.readFixed(4, floatOrder(info))
 		if err != nil {
 			return err
 		}
 
-		val.SetFloat(float64(math.Float32frombits(binary.BigEndian.Uint32(u.buffer[0:4]))))
+		val.SetFloat(float64(math.Float32frombits(uint32(num))))
 
 		return nil
 
 	case reflect.Float64:
-		n, err := io.ReadFull(u.reader, u.buffer[0:8])
-		u.read += uint64(n)
+		num, err := u.readFixed(8, floatOrder(info))
 		if err != nil {
 			return err
 		}
 
-		val.SetFloat(math.Float64frombits(binary.BigEndian.Uint64(u.buffer[0:8])))
+		val.SetFloat(math.Float64frombits(num))
 
 		return nil
 
 	case reflect.Complex64:
-		n, err := io.ReadFull(u.reader, u.buffer[0:8])
-		u.read += uint64(n)
+		r, err := u.readFixed(4, floatOrder(info))
 		if err != nil {
 			return err
 		}
 
-		var (
-			r = float64(math.Float32frombits(binary.BigEndian.Uint32(u.buffer[0:4])))
-			i = float64(math.Float32frombits(binary.BigEndian.Uint32(u.buffer[4:8])))
-		)
+		i, err := u.readFixed(4, floatOrder(info))
+		if err != nil {
+			return err
+		}
 
-		val.SetComplex(complex(r, i))
+		val.SetComplex(complex(
+			float64(math.Float32frombits(uint32(r))),
+			float64(math.Float32frombits(uint32(i))),
+		))
 
 		return nil
 
 	case reflect.Complex128:
-		n, err := io.ReadFull(u.reader, u.buffer[0:8])
-		u.read += uint64(n)
+		r, err := u.readFixed(8, floatOrder(info))
 		if err != nil {
 			return err
 		}
 
-		var r = math.Float64frombits(binary.BigEndian.Uint64(u.buffer[0:8]))
-
-		n, err = io.ReadFull(u.reader, u.buffer[0:8])
-		u.read += uint64(n)
+		i, err := u.readFixed(8, floatOrder(info))
 		if err != nil {
 			return err
 		}
 
-		var i = math.Float64frombits(binary.BigEndian.Uint64(u.buffer[0:8]))
-
-		val.SetComplex(complex(r, i))
+		val.SetComplex(complex(math.Float64frombits(r), math.Float64frombits(i)))
 
 		return nil
 
 	case reflect.Array:
 
 		var (
-			isInterface = typ.Elem().Kind() == reflect.Interface
+			isInterface = typ.Elem().Kind() == reflect.Interface && !isFileType(typ.Elem())
 			ln          = typ.Len()
 		)
 
@@ -468,28 +625,32 @@ func (u *unpacker) decode(data any, info packerInfo) error {
 			return &ErrDataTooLarge{max: u.sizelimit, size: u.read + uint64(ln) - (u.stopat - u.sizelimit)}
 		}
 
+		if info.delta != deltaNone && isDeltaKind(typ.Elem().Kind()) {
+			return u.decodeDelta(val, info)
+		}
+
 		if isInterface {
 			if objects, ok := u.subobj[info.objects]; ok {
 				for i := 0; i < ln; i++ {
 					err := u.decodeObject(val.Index(i).Addr().Interface(), objects, packerInfo{})
 					if err != nil {
-						return err
+						return inPath(err, "["+strconv.Itoa(i)+"]")
 					}
 				}
 			} else {
 				for i := 0; i < ln; i++ {
-					elem, err := u.decodeMarked(packerInfo{})
+					elem, err := u.decodeMarked(info.elem())
 					if err != nil {
-						return err
+						return inPath(err, "["+strconv.Itoa(i)+"]")
 					}
 					val.Index(i).Set(elem)
 				}
 			}
 		} else {
 			for i := 0; i < ln; i++ {
-				err := u.decode(val.Index(i).Addr().Interface(), packerInfo{})
+				err := u.decode(val.Index(i).Addr().Interface(), info.elem())
 				if err != nil {
-					return err
+					return inPath(err, "["+strconv.Itoa(i)+"]")
 				}
 			}
 		}
@@ -498,10 +659,20 @@ func (u *unpacker) decode(data any, info packerInfo) error {
 
 	case reflect.Map:
 		var (
-			isInterface = typ.Elem().Kind() == reflect.Interface
+			isInterface = typ.Elem().Kind() == reflect.Interface && !isFileType(typ.Elem())
 			ln          int64
+			ref         = -1
 		)
 
+		if u.preserve {
+			done, id, err := u.decodeRef(val)
+			if done || err != nil {
+				return err
+			}
+
+			ref = id
+		}
+
 		n, err := ReadVarInt(u.reader, &ln, u.buffer[:])
 		u.read += uint64(n)
 		if err != nil {
@@ -522,7 +693,15 @@ func (u *unpacker) decode(data any, info packerInfo) error {
 			return &ErrDataTooLarge{max: u.sizelimit, size: u.read + uint64(ln) - (u.stopat - u.sizelimit)}
 		}
 
-		val.Set(reflect.MakeMap(typ))
+		if u.reuse && !val.IsNil() {
+			val.Clear()
+		} else {
+			val.Set(reflect.MakeMap(typ))
+		}
+
+		if ref >= 0 {
+			u.refs[ref] = reflect.ValueOf(val.Interface())
+		}
 
 		if isInterface {
 
@@ -530,7 +709,7 @@ func (u *unpacker) decode(data any, info packerInfo) error {
 				for i := 0; i < int(ln); i++ {
 					curKey := reflect.New(typ.Key())
 
-					err := u.decode(curKey.Interface(), packerInfo{})
+					err := u.decode(curKey.Interface(), packerInfo{intern: info.intern})
 					if err != nil {
 						return err
 					}
@@ -539,7 +718,7 @@ func (u *unpacker) decode(data any, info packerInfo) error {
 
 					err = u.decodeObject(curVal.Interface(), objects, packerInfo{})
 					if err != nil {
-						return err
+						return inPath(err, fmt.Sprintf("[%v]", curKey.Elem()))
 					}
 
 					val.SetMapIndex(curKey.Elem(), curVal.Elem())
@@ -548,16 +727,16 @@ func (u *unpacker) decode(data any, info packerInfo) error {
 				for i := 0; i < int(ln); i++ {
 					curKey := reflect.New(typ.Key())
 
-					err := u.decode(curKey.Interface(), packerInfo{})
+					err := u.decode(curKey.Interface(), packerInfo{intern: info.intern})
 					if err != nil {
 						return err
 					}
 
 					var curVal reflect.Value
 
-					curVal, err = u.decodeMarked(packerInfo{})
+					curVal, err = u.decodeMarked(packerInfo{intern: info.intern})
 					if err != nil {
-						return err
+						return inPath(err, fmt.Sprintf("[%v]", curKey.Elem()))
 					}
 
 					val.SetMapIndex(curKey.Elem(), curVal)
@@ -566,32 +745,44 @@ func (u *unpacker) decode(data any, info packerInfo) error {
 
 		} else {
 
+			var (
+				curKey = reflect.New(typ.Key())
+				curVal = reflect.New(typ.Elem())
+			)
+
 			for i := 0; i < int(ln); i++ {
-				curKey := reflect.New(typ.Key())
+				// Entries are copied into the map, so the same receivers
+				// are used for every entry
+				curKey.Elem().SetZero()
+				curVal.Elem().SetZero()
 
-				err := u.decode(curKey.Interface(), packerInfo{})
+				err := u.decode(curKey.Interface(), packerInfo{intern: info.intern})
 				if err != nil {
 					return err
 				}
 
-				var curVal reflect.Value
-
-				curVal = reflect.New(typ.Elem())
-
-				err = u.decode(curVal.Interface(), packerInfo{})
+				err = u.decode(curVal.Interface(), packerInfo{intern: info.intern})
 				if err != nil {
-					return err
+					return inPath(err, fmt.Sprintf("[%v]", curKey.Elem()))
 				}
 
-				curVal = curVal.Elem()
-
-				val.SetMapIndex(curKey.Elem(), curVal)
+				val.SetMapIndex(curKey.Elem(), curVal.Elem())
 			}
 		}
 
 		return nil
 
 	case reflect.Slice:
+		var ref = -1
+
+		if u.preserve {
+			done, id, err := u.decodeRef(val)
+			if done || err != nil {
+				return err
+			}
+
+			ref = id
+		}
 
 		var ln uint64
 
@@ -604,23 +795,50 @@ func (u *unpacker) decode(data any, info packerInfo) error {
 		switch typ.Elem().Kind() {
 		case reflect.Uint8:
 
-			data, err := u.decodeBytes(ln, info)
+			var buf []byte
+			if u.reuse {
+				buf = val.Bytes()
+			}
+
+			data, err := u.decodeBytes(ln, info, buf)
 			if err != nil {
 				return err
 			}
 
 			val.SetBytes(data)
 
+			if ref >= 0 {
+				u.refs[ref] = reflect.ValueOf(val.Interface())
+			}
+
 			return nil
 
 		case reflect.Bool:
 
-			data, err := u.decodeBoolSlice(ln, info)
+			var (
+				ptr, isBools = val.Addr().Interface().(*[]bool)
+
+				buf []bool
+			)
+
+			if u.reuse && isBools {
+				buf = *ptr
+			}
+
+			data, err := u.decodeBoolSlice(ln, info, buf)
 			if err != nil {
 				return err
 			}
 
-			val.Set(reflect.ValueOf(data))
+			if isBools {
+				*ptr = data
+			} else {
+				val.Set(reflect.ValueOf(data))
+			}
+
+			if ref >= 0 {
+				u.refs[ref] = reflect.ValueOf(val.Interface())
+			}
 
 			return nil
 
@@ -634,23 +852,37 @@ func (u *unpacker) decode(data any, info packerInfo) error {
 			return &ErrDataTooLarge{max: u.sizelimit, size: u.read + ln - (u.stopat - u.sizelimit)}
 		}
 
-		var isInterface = typ.Elem().Kind() == reflect.Interface
+		var isInterface = typ.Elem().Kind() == reflect.Interface && !isFileType(typ.Elem())
 
-		val.Set(reflect.MakeSlice(typ, int(ln), int(ln)))
+		if u.reuse && uint64(val.Cap()) >= ln {
+			val.SetLen(int(ln))
+		} else {
+			val.Set(reflect.MakeSlice(typ, int(ln), int(ln)))
+		}
+
+		// Registered before its elements are decoded, so they may reference
+		// it, they are decoded in place into the same backing array
+		if ref >= 0 {
+			u.refs[ref] = reflect.ValueOf(val.Interface())
+		}
+
+		if info.delta != deltaNone && isDeltaKind(typ.Elem().Kind()) {
+			return u.decodeDelta(val, info)
+		}
 
 		if isInterface {
 			if objects, ok := u.subobj[info.objects]; ok {
 				for i := 0; i < int(ln); i++ {
 					err := u.decodeObject(val.Index(i).Addr().Interface(), objects, packerInfo{})
 					if err != nil {
-						return err
+						return inPath(err, "["+strconv.Itoa(i)+"]")
 					}
 				}
 			} else {
 				for i := 0; i < int(ln); i++ {
-					curItem, err := u.decodeMarked(packerInfo{})
+					curItem, err := u.decodeMarked(info.elem())
 					if err != nil {
-						return err
+						return inPath(err, "["+strconv.Itoa(i)+"]")
 					}
 
 					val.Index(i).Set(curItem)
@@ -658,9 +890,9 @@ func (u *unpacker) decode(data any, info packerInfo) error {
 			}
 		} else {
 			for i := 0; i < int(ln); i++ {
-				err := u.decode(val.Index(i).Addr().Interface(), packerInfo{})
+				err := u.decode(val.Index(i).Addr().Interface(), info.elem())
 				if err != nil {
-					return err
+					return inPath(err, "["+strconv.Itoa(i)+"]")
 				}
 			}
 		}
@@ -668,6 +900,17 @@ func (u *unpacker) decode(data any, info packerInfo) error {
 		return nil
 
 	case reflect.String:
+		if info.intern || u.intern {
+			str, err := u.decodeInterned(info)
+			if err != nil {
+				return err
+			}
+
+			val.SetString(str)
+
+			return nil
+		}
+
 		var ln uint64
 
 		n, err := ReadVarUint(u.reader, &ln, u.buffer[:])
@@ -676,7 +919,7 @@ func (u *unpacker) decode(data any, info packerInfo) error {
 			return err
 		}
 
-		buf, err := u.decodeBytes(ln, info)
+		buf, err := u.decodeBytes(ln, info, nil)
 		if err != nil {
 			return err
 		}
@@ -686,33 +929,92 @@ func (u *unpacker) decode(data any, info packerInfo) error {
 		return nil
 
 	case reflect.Struct:
-		ln := typ.NumField()
+		var (
+			st     = structFields(typ)
+			fields = st.fields
+
+			small    [8]byte
+			presence = small[:]
+		)
 
-		for i := 0; i < ln; i++ {
-			var curFieldTyp = typ.Field(i)
+		if st.err != nil {
+			return st.err
+		}
 
-			if !curFieldTyp.IsExported() {
-				continue
+		if st.hooked {
+			val.Addr().Interface().(PackDefaults).PackDefaults()
+		}
+
+		if st.optional > 0 {
+			if ln := (st.optional + 7) / 8; ln <= len(small) {
+				presence = small[:ln]
+			} else {
+				presence = make([]byte, ln)
 			}
 
-			var (
-				curVal = val.Field(i)
+			err := u.readPresence(presence)
+			if err != nil {
+				return err
+			}
+		}
 
-				curInfo = parsePackerInfo(curFieldTyp.Tag.Get("pack"))
+		for i := 0; i < len(fields); i++ {
+			var (
+				field   = fields[i]
+				curVal  = val.Field(field.index)
+				curInfo = field.info
 
-				isInterface = curFieldTyp.Type.Kind() == reflect.Interface
+				isInterface = field.isInterface
 			)
 
+			if field.bit >= 0 && presence[field.bit/8]&(1<<(field.bit%8)) == 0 {
+				// Set to the value of the default tag or keep the one set by
+				// PackDefaults, whatever the destination held before
+				switch {
+				case field.hooked:
+				case field.def.IsValid():
+					curVal.Set(field.def)
+				default:
+					curVal.SetZero()
+				}
+
+				err := field.check(curVal)
+				if err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			if field.bitRun > 0 {
+				var run = fields[i : i+field.bitRun]
+
+				err := u.decodeBits(val, run)
+				if err != nil {
+					return err
+				}
+
+				for j := range run {
+					err := run[j].check(val.Field(run[j].index))
+					if err != nil {
+						return err
+					}
+				}
+
+				i += field.bitRun - 1
+				continue
+			}
+
 			if isInterface {
 				if objects, ok := u.subobj[curInfo.objects]; ok {
 					err := u.decodeObject(curVal.Addr().Interface(), objects, curInfo)
 					if err != nil {
-						return err
+						return inPath(err, "."+field.name)
 					}
 				} else {
 					item, err := u.decodeMarked(curInfo)
 					if err != nil {
-						return err
+						return inPath(err, "."+field.name)
 					}
 
 					if (item != reflect.Value{}) {
@@ -722,9 +1024,14 @@ func (u *unpacker) decode(data any, info packerInfo) error {
 			} else {
 				err := u.decode(curVal.Addr().Interface(), curInfo)
 				if err != nil {
-					return err
+					return inPath(err, "."+field.name)
 				}
 			}
+
+			err := field.check(curVal)
+			if err != nil {
+				return err
+			}
 		}
 
 		if val.CanAddr() && reflect.PointerTo(typ).Implements(interfaceAfterUnpack) {
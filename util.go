@@ -27,6 +27,16 @@ func (l *limitedWriter) Write(b []byte) (n int, err error) {
 	return
 }
 
+// Writer appending to a byte slice, used by AppendMarshal
+type appendWriter struct {
+	buf []byte
+}
+
+func (a *appendWriter) Write(b []byte) (n int, err error) {
+	a.buf = append(a.buf, b...)
+	return len(b), nil
+}
+
 type limitedReader struct {
 	// Original limit
 	O uint64
@@ -54,3 +64,37 @@ func (l *limitedReader) Read(b []byte) (n int, err error) {
 
 	return
 }
+
+// Reader over a byte slice, which in zero-copy mode hands out parts of the
+// slice itself instead of copying them
+type sliceReader struct {
+	buf []byte
+	off int
+}
+
+func (s *sliceReader) Read(b []byte) (n int, err error) {
+	if s.off >= len(s.buf) {
+		if len(b) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+
+	n = copy(b, s.buf[s.off:])
+	s.off += n
+
+	return
+}
+
+// Get the next n bytes of the slice without copying them
+func (s *sliceReader) next(n uint64) ([]byte, error) {
+	if n > uint64(len(s.buf)-s.off) {
+		s.off = len(s.buf)
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	b := s.buf[s.off : s.off+int(n) : s.off+int(n)]
+	s.off += int(n)
+
+	return b, nil
+}
@@ -0,0 +1,224 @@
+package pack
+
+import (
+	"cmp"
+	"errors"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var typeBytes = reflect.TypeOf([]byte{})
+
+// Checks of the validation tags of a struct field, applied once it's decoded
+type validation struct {
+	nonzero bool
+	utf8    bool
+
+	// As written in the tag, parsed by compile once the type of the field
+	// is known
+	rawMin, rawMax, rawOneOf, rawLen string
+
+	min, max reflect.Value
+	oneOf    []reflect.Value
+
+	hasLen         bool
+	minLen, maxLen uint64
+}
+
+// Get the validation of the info, creating it if needed
+func (i *packerInfo) rules() *validation {
+	if i.validate == nil {
+		i.validate = &validation{}
+	}
+
+	return i.validate
+}
+
+func isNumberKind(kind reflect.Kind) bool {
+	return isDeltaKind(kind) || kind == reflect.Float32 || kind == reflect.Float64
+}
+
+// Parse the values in the tags for a field of typ, returning the tag at fault
+// if one is malformed
+func (v *validation) compile(typ reflect.Type) (string, error) {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	var (
+		kind    = typ.Kind()
+		numeric = isNumberKind(kind)
+		err     error
+	)
+
+	if v.rawMin != "" {
+		if !numeric {
+			return "min:" + v.rawMin, errors.New("only numbers may have a minimum")
+		}
+
+		v.min, err = parseTagValue(typ, v.rawMin)
+		if err != nil {
+			return "min:" + v.rawMin, err
+		}
+	}
+
+	// On other kinds max limits the size instead
+	if v.rawMax != "" && numeric {
+		v.max, err = parseTagValue(typ, v.rawMax)
+		if err != nil {
+			return "max:" + v.rawMax, err
+		}
+	}
+
+	if v.rawOneOf != "" {
+		if kind != reflect.String && !isDeltaKind(kind) {
+			return "oneof:" + v.rawOneOf, errors.New("only strings and integers may be one of a set")
+		}
+
+		for _, opt := range strings.Split(v.rawOneOf, "|") {
+			val, err := parseTagValue(typ, opt)
+			if err != nil {
+				return "oneof:" + v.rawOneOf, err
+			}
+
+			v.oneOf = append(v.oneOf, val)
+		}
+	}
+
+	if v.rawLen != "" {
+		if kind != reflect.String && kind != reflect.Slice && kind != reflect.Map {
+			return "len:" + v.rawLen, errors.New("only strings, slices and maps have a length")
+		}
+
+		lo, hi, isRange := strings.Cut(v.rawLen, "-")
+
+		v.hasLen = true
+		v.minLen, err = strconv.ParseUint(lo, 10, 64)
+		v.maxLen = v.minLen
+
+		if err == nil && isRange {
+			v.maxLen = math.MaxUint64
+			if hi != "" {
+				v.maxLen, err = strconv.ParseUint(hi, 10, 64)
+			}
+		}
+
+		if err == nil && v.minLen > v.maxLen {
+			err = errors.New("minimum length is above maximum length")
+		}
+
+		if err != nil {
+			return "len:" + v.rawLen, err
+		}
+	}
+
+	if v.utf8 && kind != reflect.String && typ != typeBytes {
+		return "utf8", errors.New("only strings and []byte may be checked for UTF-8")
+	}
+
+	return "", nil
+}
+
+// Reports whether there is anything to check
+func (v *validation) empty() bool {
+	return !v.nonzero && !v.utf8 && !v.min.IsValid() && !v.max.IsValid() && v.oneOf == nil && !v.hasLen
+}
+
+// Check a decoded struct field against its validation tags
+func (f *fieldInfo) check(val reflect.Value) error {
+	if f.info.validate == nil {
+		return nil
+	}
+
+	return inPath(f.info.validate.check(val), "."+f.name)
+}
+
+// Check a decoded value, pointers are checked by the value they point to
+func (v *validation) check(val reflect.Value) error {
+	if v.nonzero && val.IsZero() {
+		return &ErrValidation{rule: "nonzero", value: val.Interface()}
+	}
+
+	for val.Kind() == reflect.Pointer {
+		if val.IsNil() {
+			return nil
+		}
+
+		val = val.Elem()
+	}
+
+	if v.min.IsValid() && beyond(val, v.min, true) {
+		return &ErrValidation{rule: "min:" + v.rawMin, value: val.Interface()}
+	}
+
+	if v.max.IsValid() && beyond(val, v.max, false) {
+		return &ErrValidation{rule: "max:" + v.rawMax, value: val.Interface()}
+	}
+
+	if v.oneOf != nil {
+		var found bool
+
+		for _, opt := range v.oneOf {
+			if val.Equal(opt) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return &ErrValidation{rule: "oneof:" + v.rawOneOf, value: val.Interface()}
+		}
+	}
+
+	if v.hasLen {
+		if ln := uint64(val.Len()); ln < v.minLen || ln > v.maxLen {
+			return &ErrValidation{rule: "len:" + v.rawLen, value: val.Interface()}
+		}
+	}
+
+	if v.utf8 {
+		var valid bool
+
+		if val.Kind() == reflect.String {
+			valid = utf8.ValidString(val.String())
+		} else {
+			valid = utf8.Valid(val.Bytes())
+		}
+
+		if !valid {
+			return &ErrValidation{rule: "utf8", value: val.Interface()}
+		}
+	}
+
+	return nil
+}
+
+// Reports whether a number is below bound, or above it if below is false,
+// NaN is out of any range
+func beyond(val, bound reflect.Value, below bool) bool {
+	var c int
+
+	switch val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		c = cmp.Compare(val.Int(), bound.Int())
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		c = cmp.Compare(val.Uint(), bound.Uint())
+
+	default:
+		if math.IsNaN(val.Float()) {
+			return true
+		}
+
+		c = cmp.Compare(val.Float(), bound.Float())
+	}
+
+	if below {
+		return c < 0
+	}
+
+	return c > 0
+}
@@ -6,19 +6,20 @@ import (
 
 // Get the size of buffer you need to store i as a VarInt
 func SizeVarInt(i int64) (n int) {
-	// Ignore sign bit
+	// Ignore sign bit, unsigned so that math.MinInt64 doesn't overflow
+	var u = uint64(i)
 	if i < 0 {
-		i *= -1
+		u = -u
 	}
 
 	// First byte consumes 6 bits
-	i >>= 6
+	u >>= 6
 	n = 1
 
 	// Remaining bytes consume 7 bits each
-	for i != 0 {
+	for u != 0 {
 		n += 1
-		i >>= 7
+		u >>= 7
 	}
 
 	return
@@ -35,31 +36,32 @@ func PutVarInt(i int64, buf []byte) (n int) {
 	// n = negative flag
 	// d = number data
 	// Following bytes use cddddddd
+	var u = uint64(i)
 	{
 		if i < 0 {
-			i *= -1
-			buf[0] = byte(i&0x3f) | 0x40
+			u = -u
+			buf[0] = byte(u&0x3f) | 0x40
 		} else {
-			buf[0] = byte(i & 0x3f)
+			buf[0] = byte(u & 0x3f)
 		}
 
-		i >>= 6
+		u >>= 6
 
-		if i == 0 {
+		if u == 0 {
 			return
 		}
 
 		buf[0] |= 0x80
 	}
 
-	for i > 0x7f {
-		buf[n] = byte(i&0x7f) | 0x80
+	for u > 0x7f {
+		buf[n] = byte(u&0x7f) | 0x80
 		n++
 
-		i >>= 7
+		u >>= 7
 	}
 
-	buf[n] = byte(i & 0x7f)
+	buf[n] = byte(u & 0x7f)
 	n++
 
 	return
@@ -18,7 +18,7 @@ func TestVarInt(t *testing.T) {
 			0x00, 0x01, 0x7f, 0x80, -0x01, -0x7f, -0x80,
 			0xff, 0xffff, 0xffffff, 0xffffffff, -0xff, -0xffff, -0xffffff, -0xffffffff,
 
-			0x7fffffffffffffff, -0x7fffffffffffffff,
+			0x7fffffffffffffff, -0x7fffffffffffffff, -0x7fffffffffffffff - 1,
 
 			0xDEADBEEF, 0xC0FFEE, 0xCAFEBABE, 0xDEADC0DE,
 			-0xDEADBEEF, -0xC0FFEE, -0xCAFEBABE, -0xDEADC0DE,
@@ -0,0 +1,59 @@
+package pack
+
+import (
+	"io"
+)
+
+// ZigZag encoding maps signed integers to unsigned ones so that numbers
+// close to 0 stay small (0, -1, 1, -2, ... become 0, 1, 2, 3, ...), which
+// are then stored as a VarUint (LEB128), the same as protobuf's sint64
+
+func zigzag(i int64) uint64 {
+	return uint64(i<<1) ^ uint64(i>>63)
+}
+
+func unzigzag(u uint64) int64 {
+	return int64(u>>1) ^ -int64(u&1)
+}
+
+// Get the size of buffer you need to store i with ZigZag encoding
+func SizeZigZag(i int64) int {
+	return SizeVarUint(zigzag(i))
+}
+
+// Puts a number in a buffer with ZigZag encoding, returning how many bytes were written
+//
+// Buffer must be at least SizeZigZag(i) bytes long, or 10 bytes for all possible int64 values
+func PutZigZag(i int64, buf []byte) (n int) {
+	return PutVarUint(zigzag(i), buf)
+}
+
+// Writes a number to a writer with ZigZag encoding, returning how many bytes were written
+//
+// Buffer must be at least SizeZigZag(i) bytes long, or 10 bytes for all possible int64 values
+func WriteZigZag(w io.Writer, i int64, buf []byte) (n int, err error) {
+	n = PutZigZag(i, buf)
+	return w.Write(buf[:n])
+}
+
+// Gets a number with ZigZag encoding from a buffer, returning how many bytes were read
+func GetZigZag(buf []byte) (i int64, n int, err error) {
+	u, n, err := GetVarUint(buf)
+	return unzigzag(u), n, err
+}
+
+// Gets a number with ZigZag encoding from a reader, returning how many bytes were read
+//
+// Buffer must be at least SizeZigZag(i) bytes long, or 10 bytes for all possible int64 values
+func ReadZigZag(r io.Reader, i *int64, buf []byte) (int, error) {
+	var u uint64
+
+	n, err := ReadVarUint(r, &u, buf)
+	if err != nil {
+		return n, err
+	}
+
+	*i = unzigzag(u)
+
+	return n, nil
+}
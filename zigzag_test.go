@@ -0,0 +1,90 @@
+package pack
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestZigZag(t *testing.T) {
+
+	t.Parallel()
+
+	var (
+		b dataBuffer
+
+		buf = bytes.NewBuffer(nil)
+
+		inputs = []int64{
+			0x00, 0x01, 0x3f, 0x40, -0x01, -0x40, -0x41,
+			0xff, 0xffff, 0xffffff, 0xffffffff, -0xff, -0xffff, -0xffffff, -0xffffffff,
+
+			math.MaxInt64, math.MinInt64,
+
+			0xDEADBEEF, 0xC0FFEE, 0xCAFEBABE, 0xDEADC0DE,
+			-0xDEADBEEF, -0xC0FFEE, -0xCAFEBABE, -0xDEADC0DE,
+		}
+
+		// Encodings shared with protobuf's sint64
+		known = map[int64][]byte{
+			0:    {0x00},
+			-1:   {0x01},
+			1:    {0x02},
+			-2:   {0x03},
+			-150: {0xab, 0x02},
+
+			math.MaxInt32: {0xfe, 0xff, 0xff, 0xff, 0x0f},
+			math.MinInt32: {0xff, 0xff, 0xff, 0xff, 0x0f},
+		}
+	)
+
+	for _, input := range inputs {
+
+		buf.Reset()
+
+		expectedSize := SizeZigZag(input)
+
+		written, err := WriteZigZag(buf, input, b[:])
+		if err != nil {
+			t.Error(err)
+		}
+
+		if written != expectedSize {
+			t.Errorf("Expected bytes written by WriteZigZag(%d) to be %d, got %d", input, expectedSize, written)
+		}
+
+		output, getRead, err := GetZigZag(buf.Bytes())
+		if err != nil {
+			t.Error(err)
+		}
+
+		if input != output {
+			t.Errorf("Expected result from GetZigZag(%d) to be the same as input to WriteZigZag(...): got %d, expected %d", input, output, input)
+		}
+
+		if written != getRead {
+			t.Errorf("Expected bytes read by GetZigZag(%d) to be the same as bytes written by WriteZigZag(...): got %d, expected %d", input, getRead, written)
+		}
+
+		read, err := ReadZigZag(buf, &output, b[:])
+		if err != nil {
+			t.Error(err)
+		}
+
+		if input != output {
+			t.Errorf("Expected result from ReadZigZag(%d) to be the same as input to WriteZigZag(...): got %d, expected %d", input, output, input)
+		}
+
+		if written != read {
+			t.Errorf("Expected bytes read by ReadZigZag(%d) to be the same as bytes written by WriteZigZag(...): got %d, expected %d", input, read, written)
+		}
+	}
+
+	for input, expected := range known {
+		n := PutZigZag(input, b[:])
+
+		if !bytes.Equal(b[:n], expected) {
+			t.Errorf("Expected PutZigZag(%d) to be %x, got %x", input, expected, b[:n])
+		}
+	}
+}